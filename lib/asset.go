@@ -0,0 +1,518 @@
+package funimation
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AssetKind is what a video is to its page, taken from its playlist item
+type AssetKind string
+
+const (
+	EpisodeAsset AssetKind = "episode"
+	TrailerAsset AssetKind = "trailer"
+	ClipAsset    AssetKind = "clip"
+	ExtraAsset   AssetKind = "extra"
+	MovieAsset   AssetKind = "movie"
+)
+
+// AssetKinds is every kind of asset, in the order they are listed
+var AssetKinds = []AssetKind{EpisodeAsset, TrailerAsset, ClipAsset, ExtraAsset, MovieAsset}
+
+// ParseAssetKind accepts the name of a kind, singular or plural
+func ParseAssetKind(kindStr string) (AssetKind, error) {
+	kindStr = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(kindStr)), "s")
+	for _, kind := range AssetKinds {
+		if kindStr == string(kind) {
+			return kind, nil
+		}
+	}
+
+	return "", fmt.Errorf("asset: unknown kind %q", kindStr)
+}
+
+// parseAssetKind reads the kind of a playlist item in the same way as
+// parseEpisodeType reads its type. Items that don't say are episodes.
+func parseAssetKind(itemClass, videoType string) AssetKind {
+	if c, ok := lookupItemClass(itemClass, videoType); ok {
+		return c.kind
+	}
+
+	return EpisodeAsset
+}
+
+// section is the part of a show's listing that has assets of this kind
+func (k AssetKind) section() string {
+	return string(k) + "s"
+}
+
+// Asset is a single video on a page, with its own languages, qualities and
+// urls. Most pages only have the episode itself, but some also have
+// trailers, extras or alternate cuts in other players.
+type Asset struct {
+	playerId    string
+	kind        AssetKind
+	episodeType EpisodeType
+
+	seasonNum int
+	number    float32
+	title     string
+	summary   string
+
+	videoUrls  map[EpisodeLanguage]map[EpisodeQuality]string
+	funIds     map[EpisodeLanguage]string
+	durations  map[EpisodeLanguage]time.Duration
+	authTokens map[EpisodeLanguage]string
+
+	// renditions are every video of each language, of which the first is the
+	// one the maps above are taken from
+	renditions map[EpisodeLanguage][]*Rendition
+
+	// episode is the page the asset was found on, to fetch it again from
+	episode *Episode
+}
+
+func newAsset(playerData *playerData) (*Asset, error) {
+	a := &Asset{
+		playerId:   playerData.playerId,
+		funIds:     make(map[EpisodeLanguage]string),
+		videoUrls:  make(map[EpisodeLanguage]map[EpisodeQuality]string),
+		durations:  make(map[EpisodeLanguage]time.Duration),
+		authTokens: make(map[EpisodeLanguage]string),
+		renditions: make(map[EpisodeLanguage][]*Rendition),
+	}
+
+	found := false
+	for _, pli := range playerData.playlist {
+		err := a.handlePlaylistItem(pli)
+		if err == nil {
+			found = true
+		} else if err != NotFound {
+			return nil, err
+		}
+	}
+
+	if !found {
+		return nil, NotFound
+	}
+
+	return a, nil
+}
+
+// PlayerId returns the id of the player on the page that plays this video
+func (a *Asset) PlayerId() (string) {
+	return a.playerId
+}
+
+func (a *Asset) Kind() (AssetKind) {
+	return a.kind
+}
+
+func (a *Asset) SeasonNumber() (int) {
+	return a.seasonNum
+}
+
+func (a *Asset) Number() (float32) {
+	return a.number
+}
+
+func (a *Asset) Title() (string) {
+	return a.title
+}
+
+func (a *Asset) Summary() (string) {
+	return a.summary
+}
+
+func (a *Asset) Languages() ([]EpisodeLanguage) {
+	langs := make([]EpisodeLanguage, 0, len(a.videoUrls))
+
+	for lang, _ := range a.videoUrls {
+		langs = append(langs, lang)
+	}
+
+	return langs
+}
+
+// Duration returns the length of the video in the given language, or 0 if it
+// is not known
+func (a *Asset) Duration(lang EpisodeLanguage) (time.Duration) {
+	return a.durations[lang]
+}
+
+func (a *Asset) Qualities(lang EpisodeLanguage) ([]EpisodeQuality) {
+	urls := a.videoUrls[lang]
+	qualities := make([]EpisodeQuality, 0, len(urls))
+
+	for quality, _ := range urls {
+		qualities = append(qualities, quality)
+	}
+
+	return qualities
+}
+
+// restrictions are what the website puts in place of a video url when the
+// video may not be watched, and why
+var restrictions = map[string]string{
+	"subscriptionLoggedOut":  "This video is members only",
+	"matureContentLoggedOut": "This video is members only and you must be at least 17",
+	"nonSubscription":        "This video is only available to subscribers",
+	"matureContentLoggedIn":  "You must be at least 17",
+	"territoryUnavailable":   "This video is not available in your territory",
+}
+
+// RestrictionError is returned for a video that may not be watched, with
+// the code the website put in place of its url
+type RestrictionError struct {
+	Code   string
+	Reason string
+}
+
+func (e *RestrictionError) Error() string {
+	return e.Reason
+}
+
+// ProxyMayHelp reports whether the video is only restricted where the
+// request came from, so that it may be watched through a proxy elsewhere
+func (e *RestrictionError) ProxyMayHelp() bool {
+	return e.Code == "territoryUnavailable"
+}
+
+// LanguageError is returned when a video is not available in the requested
+// language at all
+type LanguageError struct {
+	Language  EpisodeLanguage
+	Available []EpisodeLanguage
+}
+
+func (e *LanguageError) Error() string {
+	if len(e.Available) == 0 {
+		return fmt.Sprintf("asset: no %s video", e.Language)
+	}
+
+	available := make([]string, len(e.Available))
+	for i, lang := range e.Available {
+		available[i] = string(lang)
+	}
+
+	return fmt.Sprintf("asset: no %s video, only %s", e.Language, strings.Join(available, ", "))
+}
+
+func (a *Asset) languageError(lang EpisodeLanguage) error {
+	return &LanguageError{lang, a.Languages()}
+}
+
+func (a *Asset) GetVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
+	urls, ok := a.videoUrls[lang]
+	if !ok {
+		return "", a.languageError(lang)
+	}
+
+	return videoUrl(urls, quality)
+}
+
+func videoUrl(urls map[EpisodeQuality]string, quality EpisodeQuality) (string, error) {
+	if url, ok := urls[quality]; ok {
+		if reason, ok := restrictions[url]; ok {
+			return "", &RestrictionError{url, reason}
+		}
+
+		return url, nil
+	}
+
+	return "", errors.New("No videos found with the given language and quality")
+}
+
+// Rendition is one video of an asset in one language. Most languages have
+// only one, but some have more, like an uncut and a broadcast dub.
+type Rendition struct {
+	funimationId string
+	authToken    string
+	duration     time.Duration
+	urls         map[EpisodeQuality]string
+}
+
+func (r *Rendition) FunimationId() (string) {
+	return r.funimationId
+}
+
+// Duration returns the length of the video, or 0 if it is not known
+func (r *Rendition) Duration() (time.Duration) {
+	return r.duration
+}
+
+func (r *Rendition) Qualities() ([]EpisodeQuality) {
+	qualities := make([]EpisodeQuality, 0, len(r.urls))
+
+	for quality, _ := range r.urls {
+		qualities = append(qualities, quality)
+	}
+
+	return qualities
+}
+
+func (r *Rendition) GetVideoUrl(quality EpisodeQuality) (string, error) {
+	return videoUrl(r.urls, quality)
+}
+
+// TokenExpiry returns when the auth token of the video's urls expires, or
+// the zero time if it doesn't say
+func (r *Rendition) TokenExpiry() (time.Time) {
+	return parseTokenExpiry(r.authToken)
+}
+
+// Renditions returns every video in the given language. The first is the
+// one the other methods of the asset use.
+func (a *Asset) Renditions(lang EpisodeLanguage) ([]*Rendition) {
+	return a.renditions[lang]
+}
+
+// addRendition keeps a video of the asset, and takes the urls, id, token
+// and duration of its language from it if it is the first in its language
+func (a *Asset) addRendition(lang EpisodeLanguage, r *Rendition) {
+	a.renditions[lang] = append(a.renditions[lang], r)
+	if len(a.renditions[lang]) > 1 {
+		return
+	}
+
+	a.authTokens[lang] = r.authToken
+	a.funIds[lang] = r.funimationId
+	a.durations[lang] = r.duration
+	a.videoUrls[lang] = r.urls
+}
+
+// GuessVideoUrl returns the most likely url of the video, for videos whose
+// url the website doesn't give
+func (a *Asset) GuessVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
+	guesses, err := a.GuessVideoUrls(lang, quality)
+	if err != nil {
+		return "", err
+	}
+
+	return guesses[0].Url, nil
+}
+
+func (a *Asset) getFunimationId(lang EpisodeLanguage) (string, error) {
+	fid, ok := a.funIds[lang]
+	if !ok {
+		return "", a.languageError(lang)
+	} else if fid == "" {
+		return "", fmt.Errorf("asset: no funimation id for the %s video", lang)
+	}
+
+	return fid, nil
+}
+
+// tokenExpiryPattern finds the unix time an auth token expires at, as in
+// ?exp=1500000000 or ?hdnts=exp=1500000000~hmac=...
+var tokenExpiryPattern = regexp.MustCompile(`(?:^|[?&~=])(?:exp|expires)=(\d+)`)
+
+// TokenExpiry returns when the first of the auth tokens of the video's urls
+// expires, or the zero time if none of them say
+func (a *Asset) TokenExpiry() (time.Time) {
+	var first time.Time
+	for _, token := range a.authTokens {
+		expiry := parseTokenExpiry(token)
+		if !expiry.IsZero() && (first.IsZero() || expiry.Before(first)) {
+			first = expiry
+		}
+	}
+
+	return first
+}
+
+func parseTokenExpiry(token string) (time.Time) {
+	m := tokenExpiryPattern.FindStringSubmatch(token)
+	if m == nil {
+		return time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
+
+// TokenExpired reports whether the auth token has expired, or is about to.
+// A token that doesn't say when it expires is taken to still be good.
+func (a *Asset) TokenExpired() (bool) {
+	expiry := a.TokenExpiry()
+	return !expiry.IsZero() && time.Until(expiry) < time.Minute
+}
+
+// Refresh fetches the page the video was found on again, for urls with a
+// fresh auth token, and returns the video of the same player on it. Videos
+// that were decoded outside of an episode have no page to refresh from.
+func (a *Asset) Refresh() (*Asset, error) {
+	if a.episode == nil {
+		return nil, errors.New("asset: no page to refresh from")
+	}
+
+	if err := a.episode.Refresh(); err != nil {
+		return nil, err
+	}
+
+	for _, fresh := range a.episode.Assets() {
+		if fresh.playerId == a.playerId {
+			// the page doesn't know which section it was listed in
+			refreshed := *fresh
+			refreshed.kind = a.kind
+
+			return &refreshed, nil
+		}
+	}
+
+	return nil, NotFound
+}
+
+func (a *Asset) GetBestQuality(el EpisodeLanguage, onlyAvailable bool) EpisodeQuality {
+	quality := NoQuality
+
+	if urls, ok := a.videoUrls[el]; ok {
+		for q, url := range urls {
+			if onlyAvailable && !strings.HasPrefix(url, "http") {
+				continue
+			}
+
+			if q > quality {
+				quality = q
+			}
+		}
+	}
+
+	return quality
+}
+
+func (a *Asset) handlePlaylistItem(pi playlistItem) (error) {
+	if clip, ok := pi.(*playlistItemClip); ok {
+		err := a.handlePlaylistItemClip(clip)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	} else if container, ok := pi.(*playlistItemContainer); ok {
+		found := false
+		for _, item := range container.items {
+			err := a.handlePlaylistItem(item)
+			if err == nil {
+				space := strings.LastIndex(container.title, " ")
+
+				seNum, err := strconv.ParseInt(container.title[space + 1:], 10, 32)
+				if err != nil {
+					return errors.New("episode: can't parse season number (\"" + container.title[space + 1:] + "\")")
+				}
+
+				a.seasonNum = int(seNum)
+
+				found = true
+			} else if err != NotFound {
+				return err
+			}
+		}
+
+		if found {
+			return nil
+		} else {
+			return NotFound
+		}
+	}
+
+	return NotFound
+}
+
+func (a *Asset) handlePlaylistItemClip(clip *playlistItemClip) (error) {
+	const dash = " - "
+
+	if clip.videoSet == nil || len(clip.videoSet) == 0 {
+		return NotFound
+	}
+
+	a.kind = parseAssetKind(clip.itemClass, clip.videoType)
+	a.episodeType = parseEpisodeType(clip.itemClass, clip.videoType)
+
+	a.title = clip.title
+
+	titleDash := strings.Index(a.title, dash)
+	if titleDash != -1 {
+		a.title = a.title[titleDash + len(dash):]
+	}
+
+	a.summary = clip.description
+
+	// a clip that is read again replaces the videos it had
+	for lang, _ := range a.renditions {
+		delete(a.renditions, lang)
+	}
+
+	for _, video := range clip.videoSet {
+		// collect video urls
+		urls := make(map[EpisodeQuality]string)
+
+		if video.sdUrl != "" {
+			urls[StandardDefinition] = video.sdUrl
+		}
+		if video.hdUrl != "" {
+			urls[HighDefinition] = video.hdUrl
+		}
+		if video.hd1080Url != "" {
+			urls[FullHighDefinition] = video.hd1080Url
+		}
+
+		// the token, id and urls of a video stay together, since a language
+		// may have more than one video
+		a.addRendition(video.languageMode, &Rendition{
+			funimationId: video.funimationId,
+			authToken:    video.authToken,
+			duration:     video.duration,
+			urls:         urls,
+		})
+	}
+
+	// collect episode number
+	a.number = clip.number
+
+	return nil
+}
+
+type AssetList []*Asset
+
+func (l AssetList) String() (string) {
+	var buf bytes.Buffer
+
+	for _, a := range l {
+		if a.number == 0 {
+			fmt.Fprintf(&buf, "\t%s - %s\n", a.kind, a.title)
+		} else {
+			fmt.Fprintf(&buf, "\t%s %v - %s\n", a.kind, a.number, a.title)
+		}
+
+		writeQualities(&buf, a)
+	}
+
+	return string(buf.Bytes())
+}
+
+func writeQualities(buf *bytes.Buffer, a *Asset) {
+	for _, lang := range a.Languages() {
+		fmt.Fprintf(buf, "\t\t%sbed: ", lang)
+
+		if qs := a.Qualities(lang); len(qs) > 0 {
+			qNames := make([]string, len(qs))
+			for i, q := range qs {
+				qNames[i] = q.String()
+			}
+
+			fmt.Fprintln(buf, strings.Join(qNames, ", "))
+		} else {
+			fmt.Fprintln(buf, NoQuality.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package funimation
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Availability is what was found checking the url of a video in one
+// language and quality
+type Availability struct {
+	Language EpisodeLanguage
+	Quality  EpisodeQuality
+
+	// Offered is false if the website doesn't list the quality at all
+	Offered bool
+
+	// Restriction is why the website withheld the url, if it did
+	Restriction *RestrictionError
+
+	Url         string
+	Status      int
+	Size        int64
+	ContentType string
+
+	// Expiry is when the url's auth token expires, or the zero time if the
+	// token doesn't say
+	Expiry time.Time
+
+	Err error
+}
+
+// Available reports whether the url was found to work
+func (av *Availability) Available() bool {
+	return av.Err == nil && (av.Status == http.StatusOK || av.Status == http.StatusPartialContent)
+}
+
+// CheckAvailability checks the url of every language and quality of the
+// video, through the client's media route and rate limit. Urls are checked
+// with a HEAD request, or a GET of the first byte if the cdn doesn't allow
+// HEAD. Videos without a client are checked with a default one.
+func (a *Asset) CheckAvailability() ([]*Availability) {
+	client := a.client()
+	if client == nil {
+		client = NewWithHttpClient(http.DefaultClient)
+	}
+
+	var results []*Availability
+	for _, lang := range a.Languages() {
+		for _, quality := range []EpisodeQuality{StandardDefinition, HighDefinition, FullHighDefinition} {
+			av := &Availability{
+				Language: lang,
+				Quality:  quality,
+			}
+			results = append(results, av)
+
+			url, ok := a.videoUrls[lang][quality]
+			if !ok {
+				continue
+			}
+
+			av.Offered = true
+
+			if reason, ok := restrictions[url]; ok {
+				av.Restriction = &RestrictionError{url, reason}
+				continue
+			}
+
+			av.Url = url
+			av.Expiry = parseTokenExpiry(a.authTokens[lang])
+			av.Err = checkUrl(client, av)
+
+			client.log().Debug("checked availability", "language", lang, "quality", quality.String(), "status", av.Status, "size", av.Size)
+		}
+	}
+
+	return results
+}
+
+func checkUrl(client *Client, av *Availability) error {
+	req, err := http.NewRequest("HEAD", av.Url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.probe(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented {
+		req, err := http.NewRequest("GET", av.Url, nil)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Range", "bytes=0-0")
+
+		if res, err = client.probe(req); err != nil {
+			return err
+		}
+		res.Body.Close()
+	}
+
+	av.Status = res.StatusCode
+	av.Size = res.ContentLength
+	av.ContentType = res.Header.Get("Content-Type")
+
+	// a partial response only has the length of the part
+	if res.StatusCode == http.StatusPartialContent {
+		av.Size = -1
+		if i := strings.LastIndexByte(res.Header.Get("Content-Range"), '/'); i != -1 {
+			if size, err := strconv.ParseInt(res.Header.Get("Content-Range")[i+1:], 10, 64); err == nil {
+				av.Size = size
+			}
+		}
+	}
+
+	return nil
+}
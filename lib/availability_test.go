@@ -0,0 +1,118 @@
+package funimation
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckAvailability(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.TokenLifetime = time.Hour
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/territory-blocked/videos/official/TB-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[EpisodeLanguage]map[EpisodeQuality]*Availability)
+	for _, av := range ep.Video().CheckAvailability() {
+		if found[av.Language] == nil {
+			found[av.Language] = make(map[EpisodeQuality]*Availability)
+		}
+		found[av.Language][av.Quality] = av
+	}
+
+	sd := found[Subbed][StandardDefinition]
+	if !sd.Available() || sd.Size <= 0 || sd.Url == "" {
+		t.Errorf("sub 480p: got status %d, size %d, error %v", sd.Status, sd.Size, sd.Err)
+	}
+
+	if until := time.Until(sd.Expiry); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("sub 480p: token expires at %v", sd.Expiry)
+	}
+
+	for _, av := range []*Availability{found[Subbed][HighDefinition], found[Dubbed][StandardDefinition]} {
+		if !av.Offered || av.Restriction == nil || !av.Restriction.ProxyMayHelp() || av.Available() {
+			t.Errorf("%s %s: got restriction %v, status %d", av.Language, av.Quality, av.Restriction, av.Status)
+		}
+	}
+
+	if fhd := found[Subbed][FullHighDefinition]; fhd.Offered || fhd.Available() {
+		t.Error("sub 1080p should not be offered")
+	}
+}
+
+func TestCheckAvailabilityWithoutHead(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	a := &Asset{
+		videoUrls:  map[EpisodeLanguage]map[EpisodeQuality]string{Subbed: {StandardDefinition: srv.URL + "/video.mp4"}},
+		authTokens: map[EpisodeLanguage]string{Subbed: "?exp=1500000000"},
+	}
+
+	av := a.CheckAvailability()[0]
+	if av.Status != http.StatusPartialContent || av.Size != int64(len(data)) || !av.Available() {
+		t.Errorf("got status %d, size %d, error %v", av.Status, av.Size, av.Err)
+	}
+
+	if !av.Expiry.Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("got expiry %v", av.Expiry)
+	}
+}
+
+func TestCheckAvailabilityLimitedAndRetried(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		// every url fails on its first request
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(make([]byte, 100)))
+	}))
+	defer srv.Close()
+
+	client := NewWithHttpClient(srv.Client())
+	client.SetRequestRate(10, 1)
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, Statuses: []int{http.StatusServiceUnavailable}})
+
+	a := &Asset{
+		videoUrls: map[EpisodeLanguage]map[EpisodeQuality]string{Subbed: {
+			StandardDefinition: srv.URL + "/sd.mp4",
+			HighDefinition:     srv.URL + "/hd.mp4",
+		}},
+		episode: &Episode{client: client},
+	}
+
+	start := time.Now()
+	for _, av := range a.CheckAvailability() {
+		if av.Offered && !av.Available() {
+			t.Errorf("%s: got status %d, error %v", av.Quality, av.Status, av.Err)
+		}
+	}
+
+	// four requests, of which only the first is in the burst
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("four probes took %v, faster than the rate limit allows", elapsed)
+	}
+}
@@ -0,0 +1,408 @@
+package funimation
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"golang.ssttevee.com/funimation/lib/redact"
+	"golang.ssttevee.com/funimation/lib/scrape"
+)
+
+// Stage is a step of getting a video from the website
+type Stage string
+
+const (
+	ShowStage    Stage = "getShow"
+	ListingStage Stage = "listing"
+	PlayersStage Stage = "playersData"
+	UrlStage     Stage = "url"
+)
+
+// StageResult is how a stage of a diagnosis went
+type StageResult struct {
+	Stage Stage
+
+	// Err is why the stage failed, or nil if it passed
+	Err error
+
+	// Skipped is true if an earlier stage failed
+	Skipped bool
+
+	// Shape describes the structure of what the stage received, so that
+	// changes to the website can be spotted
+	Shape string
+
+	// Detail is a summary of what the stage found
+	Detail string
+}
+
+// Response is a response received during a diagnosis, with auth tokens,
+// cookies and user ids removed
+type Response struct {
+	Stage  Stage
+	Url    string
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type Diagnosis struct {
+	Show      string
+	Stages    []*StageResult
+	Responses []*Response
+}
+
+// Failed returns the stage that failed, or nil if every stage passed
+func (d *Diagnosis) Failed() (*StageResult) {
+	for _, r := range d.Stages {
+		if r.Err != nil {
+			return r
+		}
+	}
+
+	return nil
+}
+
+func (d *Diagnosis) String() (string) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "Diagnosis of %s\n\n", d.Show)
+
+	for _, r := range d.Stages {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(&buf, "%-12s skipped\n", r.Stage)
+			continue
+		case r.Err != nil:
+			fmt.Fprintf(&buf, "%-12s FAILED  %v\n", r.Stage, r.Err)
+		default:
+			fmt.Fprintf(&buf, "%-12s ok      %s\n", r.Stage, r.Detail)
+		}
+
+		if r.Err != nil && r.Detail != "" {
+			fmt.Fprintf(&buf, "%-12s found   %s\n", "", r.Detail)
+		}
+		if r.Shape != "" {
+			fmt.Fprintf(&buf, "%-12s got     %s\n", "", r.Shape)
+		}
+	}
+
+	return string(buf.Bytes())
+}
+
+// WriteBundle writes a zip file with the report and every response received,
+// for attaching to a bug report
+func (d *Diagnosis) WriteBundle(w io.Writer) (error) {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("report.txt")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(f, d.String()); err != nil {
+		return err
+	}
+
+	for i, res := range d.Responses {
+		f, err := zw.Create(fmt.Sprintf("responses/%02d-%s.http", i + 1, res.Stage))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(f, "GET %s\n%d %s\n", res.Url, res.Status, http.StatusText(res.Status))
+		res.Header.Write(f)
+		fmt.Fprintln(f)
+		f.Write(res.Body)
+	}
+
+	return zw.Close()
+}
+
+// captureTransport keeps a redacted copy of every response
+type captureTransport struct {
+	rt http.RoundTripper
+
+	mu        sync.Mutex
+	stage     Stage
+	responses []*Response
+}
+
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.responses = append(t.responses, &Response{
+		Stage:  t.stage,
+		Url:    redact.Url(req.URL.String()),
+		Status: res.StatusCode,
+		Header: redact.Header(res.Header),
+		Body:   redact.Body(body),
+	})
+
+	return res, nil
+}
+
+func (t *captureTransport) startStage(stage Stage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stage = stage
+}
+
+// stageResponses returns the responses received during a stage
+func (t *captureTransport) stageResponses(stage Stage) ([]*Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var responses []*Response
+	for _, res := range t.responses {
+		if res.Stage == stage {
+			responses = append(responses, res)
+		}
+	}
+
+	return responses
+}
+
+// Diagnose runs each stage of getting a video against a show: looking up the
+// show, listing its episodes, reading the players on the first episode's
+// page and resolving its video urls. It stops at the first stage that fails,
+// and is meant for finding out what changed when the website does.
+func (f *Client) Diagnose(showSlug string) (*Diagnosis) {
+	d := &Diagnosis{Show: showSlug}
+
+	rt := f.httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	capture := &captureTransport{rt: rt}
+	c := f.withHttpClient(&http.Client{
+		Jar:           f.httpClient.Jar,
+		Transport:     capture,
+		CheckRedirect: f.httpClient.CheckRedirect,
+		Timeout:       f.httpClient.Timeout,
+	})
+
+	var series *Series
+	var card scrape.Item
+	var ep *Episode
+
+	stages := []struct {
+		stage Stage
+		run   func(r *StageResult) error
+	}{
+		{ShowStage, func(r *StageResult) error {
+			var err error
+			if series, err = c.GetSeries(showSlug); err != nil {
+				return err
+			}
+
+			r.Detail = fmt.Sprintf("show %d, %q", series.showId, series.name)
+			return nil
+		}},
+		{ListingStage, func(r *StageResult) error {
+			ajax, err := getJsonObject(c, listingUrl("episodes", series.showId, 1, 0))
+			if err != nil {
+				return err
+			}
+
+			main, ok := ajax["main"].(string)
+			if !ok {
+				return errors.New("listing: no html in response")
+			}
+
+			cards, err := extractCards(main)
+			if err != nil {
+				return err
+			} else if len(cards) == 0 {
+				return errNoCards
+			}
+
+			card = cards[0]
+
+			var missing []string
+			for field, _ := range listingRules.Fields {
+				if card.Get(field) == "" {
+					missing = append(missing, field)
+				}
+			}
+			sort.Strings(missing)
+
+			r.Detail = fmt.Sprintf("first card links to %s", card.Get("url"))
+			if len(missing) > 0 {
+				r.Detail += fmt.Sprintf(", missing %s", strings.Join(missing, ", "))
+			}
+
+			if card.Get("url") == "" {
+				return errors.New("listing: episode card has no url")
+			}
+
+			return nil
+		}},
+		{PlayersStage, func(r *StageResult) error {
+			playersData, err := getPlayersDataFromUrl(c, card.Get("url"))
+			if err != nil {
+				return err
+			}
+
+			ep = &Episode{client: c, url: card.Get("url")}
+			if err := ep.collectPlayersData(playersData); err != nil {
+				return err
+			}
+
+			r.Detail = fmt.Sprintf("%d players, %d videos, the episode is %q", len(playersData), len(ep.assets), ep.title)
+			return nil
+		}},
+		{UrlStage, func(r *StageResult) error {
+			var found []string
+			for _, lang := range ep.Languages() {
+				for quality, url := range ep.video.videoUrls[lang] {
+					if _, ok := restrictions[url]; ok {
+						found = append(found, fmt.Sprintf("%s %s: %s", lang, quality, url))
+					} else if strings.HasPrefix(url, "http") {
+						found = append(found, fmt.Sprintf("%s %s: %s", lang, quality, redact.Url(url)))
+					} else {
+						return fmt.Errorf("url: unknown value %q for %s %s", url, lang, quality)
+					}
+				}
+			}
+
+			if len(found) == 0 {
+				return errors.New("url: no video urls found")
+			}
+
+			sort.Strings(found)
+			r.Detail = strings.Join(found, "; ")
+			return nil
+		}},
+	}
+
+	failed := false
+	for _, stage := range stages {
+		r := &StageResult{Stage: stage.stage}
+		d.Stages = append(d.Stages, r)
+
+		if failed {
+			r.Skipped = true
+			continue
+		}
+
+		capture.startStage(stage.stage)
+		r.Err = runStage(stage.run, r)
+
+		for _, res := range capture.stageResponses(stage.stage) {
+			r.Shape = bodyShape(res.Body)
+			if res.Status != 200 {
+				r.Shape = fmt.Sprintf("status %d, %s", res.Status, r.Shape)
+			}
+		}
+
+		failed = r.Err != nil
+	}
+
+	d.Responses = capture.responses
+
+	return d
+}
+
+// runStage runs a stage, turning a panic into an error, as a type assertion
+// on a changed response would
+func runStage(run func(r *StageResult) error, r *StageResult) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return run(r)
+}
+
+// bodyShape describes a response body. Json is described by its structure,
+// and html pages by their inline script data.
+func bodyShape(b []byte) (string) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		return describeShape(v, 8)
+	}
+
+	assignments, err := findPageAssignments(b)
+	if err != nil {
+		return fmt.Sprintf("%d bytes, %v", len(b), err)
+	} else if len(assignments) == 0 {
+		return fmt.Sprintf("%d bytes without script data", len(b))
+	}
+
+	var shapes []string
+	for _, a := range assignments {
+		if err := json.Unmarshal(a.Value, &v); err != nil {
+			shapes = append(shapes, a.Name + " = ?")
+		} else {
+			shapes = append(shapes, a.Name + " = " + describeShape(v, 8))
+		}
+	}
+
+	return fmt.Sprintf("%d bytes, %s", len(b), strings.Join(shapes, "; "))
+}
+
+// describeShape summarizes the structure of a json value, such as
+// {info: {show_id: string}, status: bool}. Arrays are described by their
+// length and first element.
+func describeShape(v interface{}, depth int) (string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if depth == 0 {
+			return "{...}"
+		}
+
+		keys := make([]string, 0, len(v))
+		for key, _ := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key + ": " + describeShape(v[key], depth - 1)
+		}
+
+		return "{" + strings.Join(fields, ", ") + "}"
+	case []interface{}:
+		if len(v) == 0 {
+			return "[0]"
+		} else if depth == 0 {
+			return fmt.Sprintf("[%d]...", len(v))
+		}
+
+		return fmt.Sprintf("[%d]%s", len(v), describeShape(v[0], depth - 1))
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	}
+
+	return "null"
+}
@@ -0,0 +1,111 @@
+package funimation
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+func TestDiagnose(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	d := client.Diagnose("multi-season")
+	if failed := d.Failed(); failed != nil {
+		t.Fatalf("%s failed: %v\n%s", failed.Stage, failed.Err, d)
+	}
+
+	if len(d.Stages) != 4 {
+		t.Fatalf("got %d stages, want 4", len(d.Stages))
+	}
+
+	shapes := map[Stage]string{
+		ShowStage:    "{info: {funimation_website: string, show_id: string,",
+		ListingStage: "{main: string}",
+		PlayersStage: "playersData = [1]{playerId: string, playlist: [2]{",
+	}
+
+	for _, r := range d.Stages {
+		if want, ok := shapes[r.Stage]; ok && !strings.Contains(r.Shape, want) {
+			t.Errorf("%s: got shape %s, want %s", r.Stage, r.Shape, want)
+		}
+	}
+
+	if detail := d.Stages[3].Detail; !strings.Contains(detail, "sub 480p: http") || !strings.Contains(detail, "dub 720p: subscriptionLoggedOut") {
+		t.Errorf("got urls %s", detail)
+	}
+}
+
+func TestDiagnoseFailures(t *testing.T) {
+	srv := funimationtest.NewServer(&funimationtest.Show{
+		Id:   1,
+		Slug: "broken",
+		Episodes: []*funimationtest.Episode{
+			{Slug: "broken-1", Season: 1, Number: 1, Title: "Broken", NoPlayer: true},
+		},
+	})
+	defer srv.Close()
+
+	client := NewWithHttpClient(srv.Client())
+
+	tests := []struct {
+		show   string
+		failed Stage
+		err    string
+	}{
+		{"nope", ShowStage, "Not found"},
+		{"broken", PlayersStage, "episode: no player found on page"},
+	}
+
+	for _, test := range tests {
+		d := client.Diagnose(test.show)
+
+		failed := d.Failed()
+		if failed == nil || failed.Stage != test.failed || failed.Err.Error() != test.err {
+			t.Errorf("%s: got %+v, want %s to fail with %q", test.show, failed, test.failed, test.err)
+			continue
+		}
+
+		if last := d.Stages[len(d.Stages)-1]; !last.Skipped {
+			t.Errorf("%s: expected the stages after %s to be skipped", test.show, failed.Stage)
+		}
+
+		if !strings.Contains(d.String(), "FAILED") {
+			t.Errorf("%s: report does not say what failed:\n%s", test.show, d)
+		}
+	}
+}
+
+func TestDiagnosisBundle(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	var buf bytes.Buffer
+	if err := client.Diagnose("multi-season").WriteBundle(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zr.File) != 4 {
+		t.Errorf("got %d files, want a report and 3 responses", len(zr.File))
+	}
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+
+		if strings.Contains(string(b), "token-") {
+			t.Errorf("%s contains an auth token", f.Name)
+		}
+	}
+}
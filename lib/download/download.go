@@ -0,0 +1,506 @@
+package download // import "golang.ssttevee.com/funimation/lib/download"
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// how many bytes may be received between state file writes
+const saveInterval = 1 << 20
+
+type StatusError struct {
+	Code int
+	Url  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("download: got status code %d from %s", e.Code, e.Url)
+}
+
+type Downloader struct {
+	// OnBytesReceived is called every time bytes are written to disk. It is
+	// never called concurrently.
+	OnBytesReceived func(int)
+
+	// Client is the http client used for all requests; defaults to
+	// http.DefaultClient
+	Client *http.Client
+
+	// Limiter limits the download speed, it may be shared between downloads
+	Limiter *Limiter
+
+	// TempDir is where the partial download and its state file are kept
+	// until it completes; defaults to the system's temp directory. A download
+	// that is interrupted may be resumed from here by starting it again with
+	// the same url and destination.
+	TempDir string
+
+	url          string
+	size         int64
+	etag         string
+	lastModified string
+	ranges       bool
+	hls          bool
+}
+
+type chunk struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+type state struct {
+	Url          string   `json:"url"`
+	Size         int64    `json:"size"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Chunks       []*chunk `json:"chunks,omitempty"`
+
+	// hls only, where Size is the number of segments in the playlist and
+	// Duration is the sum of their durations in seconds
+	Segments int     `json:"segments,omitempty"`
+	Offset   int64   `json:"offset,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+type Download struct {
+	dl *Downloader
+
+	size    int64
+	current int64
+
+	stateFile string
+	partFile  string
+	dest      string
+
+	state   *state
+	stateMu sync.Mutex
+
+	cbMu sync.Mutex
+
+	done chan struct{}
+	err  error
+}
+
+func isHls(u *url.URL) bool {
+	return strings.HasSuffix(u.Path, ".m3u8")
+}
+
+// Ext returns the extension of the file that a url is downloaded as. The
+// segments of an hls stream are joined into an mpeg transport stream, which
+// is a .ts file, and anything else is taken to be an .mp4 file.
+func Ext(rawUrl string) string {
+	if u, err := url.Parse(rawUrl); err == nil && isHls(u) {
+		return ".ts"
+	}
+
+	return ".mp4"
+}
+
+func New(rawUrl string) (*Downloader, error) {
+	return NewWithClient(http.DefaultClient, rawUrl)
+}
+
+func NewWithClient(client *http.Client, rawUrl string) (*Downloader, error) {
+	dl := &Downloader{
+		Client: client,
+		url:    rawUrl,
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if isHls(u) {
+		dl.hls = true
+		return dl, nil
+	}
+
+	res, err := dl.client().Head(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{res.StatusCode, rawUrl}
+	}
+
+	dl.size = res.ContentLength
+	dl.etag = res.Header.Get("ETag")
+	dl.lastModified = res.Header.Get("Last-Modified")
+	dl.ranges = res.Header.Get("Accept-Ranges") == "bytes" && dl.size > 0
+
+	return dl, nil
+}
+
+func (dl *Downloader) client() *http.Client {
+	if dl.Client == nil {
+		return http.DefaultClient
+	}
+
+	return dl.Client
+}
+
+func (dl *Downloader) tempDir() string {
+	if dl.TempDir == "" {
+		return os.TempDir()
+	}
+
+	return dl.TempDir
+}
+
+// Size returns the total size of the file in bytes, or 0 if it is not known
+// in advance, as with hls streams
+func (dl *Downloader) Size() int64 {
+	return dl.size
+}
+
+// Download starts downloading into dest using the given number of
+// concurrent connections. If a previous attempt at the same download was
+// interrupted, it continues from where that attempt left off.
+func (dl *Downloader) Download(dest string, threads int) (*Download, error) {
+	if threads < 1 {
+		threads = 1
+	}
+
+	tempDir := dl.tempDir()
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return nil, err
+	}
+
+	key := jobKey(dl.url, dest)
+
+	d := &Download{
+		dl:        dl,
+		size:      dl.size,
+		stateFile: filepath.Join(tempDir, key+".json"),
+		partFile:  filepath.Join(tempDir, key+".part"),
+		dest:      dest,
+		done:      make(chan struct{}),
+	}
+
+	d.state = d.loadState()
+
+	if dl.hls {
+		go d.finish(d.fetchHls())
+		return d, nil
+	}
+
+	fresh := d.state == nil
+	if fresh {
+		d.state = dl.newState(threads)
+	}
+
+	for _, c := range d.state.Chunks {
+		d.current += c.Done
+	}
+
+	go d.finish(d.fetchChunks(fresh))
+
+	return d, nil
+}
+
+func (dl *Downloader) newState(threads int) *state {
+	s := &state{
+		Url:          stripQuery(dl.url),
+		Size:         dl.size,
+		ETag:         dl.etag,
+		LastModified: dl.lastModified,
+	}
+
+	if !dl.ranges {
+		s.Chunks = []*chunk{{Start: 0, End: dl.size - 1}}
+		return s
+	}
+
+	// every chunk has at least a byte
+	if int64(threads) > dl.size {
+		threads = int(dl.size)
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	chunkSize := dl.size / int64(threads)
+	for i := 0; i < threads; i++ {
+		c := &chunk{
+			Start: int64(i) * chunkSize,
+			End:   int64(i+1)*chunkSize - 1,
+		}
+
+		if i == threads-1 {
+			c.End = dl.size - 1
+		}
+
+		s.Chunks = append(s.Chunks, c)
+	}
+
+	return s
+}
+
+// loadState reads the state file of a previous attempt, returning nil if
+// there is none or if it no longer matches the remote file
+func (d *Download) loadState() *state {
+	b, err := os.ReadFile(d.stateFile)
+	if err != nil {
+		return nil
+	}
+
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil
+	}
+
+	if _, err := os.Stat(d.partFile); err != nil {
+		return nil
+	}
+
+	if s.Url != stripQuery(d.dl.url) {
+		return nil
+	}
+
+	if d.dl.hls {
+		return &s
+	}
+
+	if !d.dl.ranges || s.Size != d.dl.size || s.ETag != d.dl.etag || s.LastModified != d.dl.lastModified {
+		return nil
+	}
+
+	return &s
+}
+
+func (d *Download) saveState() error {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	b, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := d.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, d.stateFile)
+}
+
+func (d *Download) fetchChunks(fresh bool) error {
+	flag := os.O_CREATE | os.O_WRONLY
+	if fresh {
+		flag |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(d.partFile, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := d.saveState(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(d.state.Chunks))
+	for _, c := range d.state.Chunks {
+		if c.End >= 0 && c.Start+c.Done > c.End {
+			continue
+		}
+
+		wg.Add(1)
+		go func(c *chunk) {
+			defer wg.Done()
+			errs <- d.fetchChunk(f, c)
+		}(c)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			d.saveState()
+			return err
+		}
+	}
+
+	return d.saveState()
+}
+
+func (d *Download) fetchChunk(f *os.File, c *chunk) error {
+	req, err := http.NewRequest("GET", d.dl.url, nil)
+	if err != nil {
+		return err
+	}
+
+	if d.dl.ranges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", c.Start+c.Done, c.End))
+	}
+
+	res, err := d.dl.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if d.dl.ranges && res.StatusCode != http.StatusPartialContent {
+		return &StatusError{res.StatusCode, d.dl.url}
+	} else if !d.dl.ranges && res.StatusCode != http.StatusOK {
+		return &StatusError{res.StatusCode, d.dl.url}
+	}
+
+	body := &limitedReader{res.Body, d.dl.Limiter}
+
+	buf := make([]byte, 32*1024)
+	var unsaved int
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if _, err := f.WriteAt(buf[:n], c.Start+c.Done); err != nil {
+				return err
+			}
+
+			d.stateMu.Lock()
+			c.Done += int64(n)
+			d.stateMu.Unlock()
+
+			d.received(n)
+
+			if unsaved += n; unsaved >= saveInterval {
+				if err := d.saveState(); err != nil {
+					return err
+				}
+				unsaved = 0
+			}
+		}
+
+		if rerr == io.EOF {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+
+	if c.End >= 0 && c.Start+c.Done <= c.End {
+		return io.ErrUnexpectedEOF
+	}
+
+	return nil
+}
+
+func (d *Download) received(n int) {
+	atomic.AddInt64(&d.current, int64(n))
+
+	if d.dl.OnBytesReceived != nil {
+		d.cbMu.Lock()
+		d.dl.OnBytesReceived(n)
+		d.cbMu.Unlock()
+	}
+}
+
+func (d *Download) finish(err error) {
+	if err == nil {
+		err = moveFile(d.partFile, d.dest)
+	}
+
+	if err == nil {
+		os.Remove(d.stateFile)
+	}
+
+	d.err = err
+	close(d.done)
+}
+
+// Wait blocks until the download completes or fails. The partial data of a
+// failed download is kept so that it may be resumed later.
+func (d *Download) Wait() error {
+	<-d.done
+	return d.err
+}
+
+func (d *Download) Current() int64 {
+	return atomic.LoadInt64(&d.current)
+}
+
+func (d *Download) Percent() float32 {
+	if d.dl.hls {
+		d.stateMu.Lock()
+		defer d.stateMu.Unlock()
+
+		if d.state == nil || d.state.Size == 0 {
+			return 0
+		}
+
+		return float32(d.state.Segments) / float32(d.state.Size)
+	}
+
+	if d.size <= 0 {
+		return 0
+	}
+
+	return float32(d.Current()) / float32(d.size)
+}
+
+func jobKey(rawUrl, dest string) string {
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		abs = dest
+	}
+
+	sum := sha1.Sum([]byte(stripQuery(rawUrl) + "\n" + abs))
+	return hex.EncodeToString(sum[:])
+}
+
+// stripQuery removes the query string, which holds the auth token and
+// changes between sessions
+func stripQuery(rawUrl string) string {
+	if i := strings.IndexByte(rawUrl, '?'); i != -1 {
+		return rawUrl[:i]
+	}
+
+	return rawUrl
+}
+
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	// probably on different devices
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,503 @@
+package download
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+
+	return b
+}
+
+func TestResumeRange(t *testing.T) {
+	tempDir := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	data := testData(3 << 20)
+
+	fail := true
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+
+		if fail && r.Method == "GET" {
+			// send a bit more than the save interval then die
+			fail = false
+			w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[:saveInterval+100])
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dl, err := New(srv.URL + "/video.mp4?token=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl.TempDir = tempDir
+
+	d, err := dl.Download(dest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Wait(); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+
+	// a new process would have a fresh auth token
+	dl, err = New(srv.URL + "/video.mp4?token=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl.TempDir = tempDir
+
+	d, err = dl.Download(dest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := fmt.Sprintf("bytes=%d-%d", saveInterval+100, len(data)-1); ranges[1] != want {
+		t.Errorf("resumed with range %q, want %q", ranges[1], want)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("temp dir not cleaned up: %d entries left", len(entries))
+	}
+}
+
+func TestMoreThreadsThanBytes(t *testing.T) {
+	tempDir := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+	data := testData(3)
+
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+
+		http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dl, err := New(srv.URL + "/video.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl.TempDir = tempDir
+
+	d, err := dl.Download(dest, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranges) != len(data) {
+		t.Errorf("got %d range requests, want one per byte: %q", len(ranges), ranges)
+	}
+
+	for _, r := range ranges {
+		if strings.Contains(r, "--") {
+			t.Errorf("requested bad range %q", r)
+		}
+	}
+
+	if got, err := os.ReadFile(dest); err != nil || !bytes.Equal(got, data) {
+		t.Error("downloaded data does not match")
+	}
+}
+
+func TestResumeHls(t *testing.T) {
+	tempDir := t.TempDir()
+	dest := filepath.Join(t.TempDir(), "video.mp4")
+
+	segments := [][]byte{testData(100), testData(200), testData(300)}
+
+	fail := true
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/video.mp4.m3u8":
+			fmt.Fprintln(w, "#EXTM3U")
+			fmt.Fprintln(w, "#EXT-X-STREAM-INF:BANDWIDTH=750000")
+			fmt.Fprintln(w, "low.m3u8")
+			fmt.Fprintln(w, "#EXT-X-STREAM-INF:BANDWIDTH=1500000")
+			fmt.Fprintln(w, "high.m3u8")
+		case "/high.m3u8":
+			fmt.Fprintln(w, "#EXTM3U")
+			for i := range segments {
+				fmt.Fprintln(w, "#EXTINF:10,")
+				fmt.Fprintf(w, "seg%d.ts\n", i)
+			}
+			fmt.Fprintln(w, "#EXT-X-ENDLIST")
+		default:
+			var i int
+			if _, err := fmt.Sscanf(r.URL.Path, "/seg%d.ts", &i); err != nil || i >= len(segments) {
+				http.NotFound(w, r)
+				return
+			}
+
+			requested = append(requested, r.URL.Path+"?"+r.URL.RawQuery)
+
+			if i == 2 && fail {
+				fail = false
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.Write(segments[i])
+		}
+	}))
+	defer srv.Close()
+
+	for _, wantErr := range []bool{true, false} {
+		dl, err := New(srv.URL + "/video.mp4.m3u8?token=a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dl.TempDir = tempDir
+
+		d, err := dl.Download(dest, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Wait(); (err != nil) != wantErr {
+			t.Fatalf("got error %v, want error: %v", err, wantErr)
+		}
+	}
+
+	if got := strings.Join(requested, " "); got != "/seg0.ts?token=a /seg1.ts?token=a /seg2.ts?token=a /seg2.ts?token=a" {
+		t.Errorf("unexpected segment requests: %s", got)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, bytes.Join(segments, nil)) {
+		t.Error("downloaded data does not match")
+	}
+}
+
+// tsData returns n transport stream packets
+func tsData(n int) []byte {
+	b := testData(n * tsPacketSize)
+	for i := 0; i < len(b); i += tsPacketSize {
+		b[i] = tsSyncByte
+	}
+
+	return b
+}
+
+func TestVerifyHls(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := t.TempDir()
+
+	segments := [][]byte{tsData(10), tsData(20), tsData(30)}
+
+	var truncate bool
+	var playlists int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/video.m3u8" {
+			playlists++
+			fmt.Fprintln(w, "#EXTM3U")
+			for i := range segments {
+				fmt.Fprintln(w, "#EXTINF:10.0,")
+				fmt.Fprintf(w, "seg%d.ts\n", i)
+			}
+			fmt.Fprintln(w, "#EXT-X-ENDLIST")
+			return
+		}
+
+		var i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/seg%d.ts", &i); err != nil || i >= len(segments) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if i == 1 && truncate {
+			w.Write(segments[i][:len(segments[i])-50])
+			return
+		}
+
+		w.Write(segments[i])
+	}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		truncate bool
+		duration time.Duration
+		wantErr  bool
+	}{
+		{false, 30 * time.Second, false},
+		{true, 30 * time.Second, true},
+		{false, 24 * time.Minute, true},
+	} {
+		truncate = test.truncate
+
+		dl, err := New(srv.URL + "/video.m3u8")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dl.TempDir = tempDir
+
+		d, err := dl.Download(filepath.Join(dir, fmt.Sprintf("video-%v-%v.ts", test.truncate, test.duration)), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the playlist the download started with is checked against, not
+		// whatever the server has by now
+		before := playlists
+
+		err = d.Verify(test.duration)
+		if _, ok := err.(*VerifyError); ok != test.wantErr {
+			t.Errorf("truncated %v, expected %v: got error %v", test.truncate, test.duration, err)
+		}
+
+		if playlists != before {
+			t.Error("verifying fetched the playlist again")
+		}
+	}
+}
+
+func TestExt(t *testing.T) {
+	tests := map[string]string{
+		"http://cdn.example.com/SV/ABC0001-480-2500K.mp4?token":            ".mp4",
+		"http://cdn.example.com/SV/ABC0001-480-,750,1500,K.mp4.m3u8?token": ".ts",
+		"http://cdn.example.com/SV/ABC0001/master.m3u8":                    ".ts",
+		"http://cdn.example.com/SV/ABC0001/video?format=m3u8":              ".mp4",
+	}
+
+	for rawUrl, want := range tests {
+		if got := Ext(rawUrl); got != want {
+			t.Errorf("%s: got %s, want %s", rawUrl, got, want)
+		}
+	}
+}
+
+func TestQueueRetries(t *testing.T) {
+	dir := t.TempDir()
+	data := testData(1000)
+
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+
+		// every file fails on its first request, and bad.bin never works
+		if n == 1 || r.URL.Path == "/bad.bin" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	q := NewQueue(2)
+	q.Retries = 2
+	q.Backoff = time.Millisecond
+	q.TempDir = filepath.Join(dir, "partial")
+
+	for _, name := range []string{"a.bin", "b.bin", "c.bin", "bad.bin"} {
+		url := srv.URL + "/" + name
+		q.Add(&Job{
+			Name: name,
+			Dest: filepath.Join(dir, name),
+			Url: func() (string, error) {
+				return url, nil
+			},
+		})
+	}
+
+	failed := q.Run()
+	if len(failed) != 1 || failed[0].Name != "bad.bin" {
+		t.Fatalf("expected only bad.bin to fail, got %d failures", len(failed))
+	}
+
+	if n := failed[0].Attempts(); n != 3 {
+		t.Errorf("bad.bin attempted %d times, want 3", n)
+	}
+
+	for _, job := range q.Jobs()[:3] {
+		if job.Status() != Done {
+			t.Errorf("%s: got status %s", job.Name, job.Status())
+		}
+
+		if got, err := os.ReadFile(job.Dest); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: downloaded data does not match", job.Name)
+		}
+	}
+
+	if _, err := os.Stat(q.TempDir); err != nil {
+		t.Errorf("queue's temp dir not used: %v", err)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.Parse("15:04", clock)
+		return tm
+	}
+
+	tests := []struct {
+		window string
+		clock  string
+		want   bool
+	}{
+		{"01:00-07:00", "00:59", false},
+		{"01:00-07:00", "01:00", true},
+		{"01:00-07:00", "06:59", true},
+		{"01:00-07:00", "07:00", false},
+		{"23:00-02:00", "23:30", true},
+		{"23:00-02:00", "01:30", true},
+		{"23:00-02:00", "12:00", false},
+	}
+
+	for _, test := range tests {
+		w, err := ParseWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := w.Contains(at(test.clock)); got != test.want {
+			t.Errorf("%s contains %s: got %v, want %v", test.window, test.clock, got, test.want)
+		}
+	}
+
+	if _, err := ParseWindow("1am-7am"); err == nil {
+		t.Error("expected error for bad window")
+	}
+}
+
+func mp4Box(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func testMp4(typ string, duration time.Duration) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration/time.Millisecond))
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		mp4Box(typ, mp4Box("mvhd", mvhd)),
+		mp4Box("mdat", testData(5000)),
+	}, nil)
+}
+
+func TestVerifyQuarantine(t *testing.T) {
+	tempDir := t.TempDir()
+	dir := t.TempDir()
+
+	// the first response has no moov box
+	files := [][]byte{testMp4("free", 1482*time.Second), testMp4("moov", 1482*time.Second)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(files[0]))
+		if r.Method == "GET" && len(files) > 1 {
+			files = files[1:]
+		}
+	}))
+	defer srv.Close()
+
+	q := NewQueue(1)
+	q.Backoff = time.Millisecond
+	q.TempDir = tempDir
+	q.Quarantine = filepath.Join(dir, "quarantine")
+	q.Add(&Job{
+		Name:     "ep1",
+		Dest:     filepath.Join(dir, "ep1.mp4"),
+		Duration: 1480 * time.Second,
+		Url: func() (string, error) {
+			return srv.URL, nil
+		},
+	})
+
+	if failed := q.Run(); len(failed) != 0 {
+		t.Fatal(failed[0].Err())
+	}
+
+	if n := q.Jobs()[0].Attempts(); n != 2 {
+		t.Errorf("attempted %d times, want 2", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(q.Quarantine, "ep1.mp4.1")); err != nil {
+		t.Errorf("bad file not quarantined: %v", err)
+	}
+}
+
+func TestMp4Duration(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "good.mp4")
+	os.WriteFile(good, testMp4("moov", 90*time.Second), 0644)
+
+	if d, err := mp4Duration(good); err != nil || d != 90*time.Second {
+		t.Errorf("got %v, %v; want 1m30s", d, err)
+	}
+
+	truncated := filepath.Join(dir, "truncated.mp4")
+	b := testMp4("moov", 90*time.Second)
+	os.WriteFile(truncated, b[:len(b)-100], 0644)
+
+	if _, err := mp4Duration(truncated); err == nil {
+		t.Error("expected error for truncated file")
+	}
+}
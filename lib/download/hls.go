@@ -0,0 +1,227 @@
+package download
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var errEncrypted = errors.New("download: encrypted hls streams are not supported")
+
+type variant struct {
+	bandwidth int
+	uri       string
+}
+
+type playlist struct {
+	variants []variant
+	segments []string
+
+	// duration is the sum of the durations of the segments
+	duration time.Duration
+}
+
+func (d *Download) getPlaylist(rawUrl string) (*playlist, error) {
+	res, err := d.dl.client().Get(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &StatusError{res.StatusCode, rawUrl}
+	}
+
+	base, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePlaylist(res.Body, base)
+}
+
+func parsePlaylist(r io.Reader, base *url.URL) (*playlist, error) {
+	p := &playlist{}
+
+	scanner := bufio.NewScanner(r)
+
+	first := true
+	bandwidth := -1
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if first {
+			if line != "#EXTM3U" {
+				return nil, errors.New("download: not an m3u8 playlist")
+			}
+			first = false
+			continue
+		}
+
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			bandwidth = 0
+			for _, attr := range strings.Split(line[len("#EXT-X-STREAM-INF:"):], ",") {
+				if strings.HasPrefix(attr, "BANDWIDTH=") {
+					bandwidth, _ = strconv.Atoi(attr[len("BANDWIDTH="):])
+				}
+			}
+		} else if strings.HasPrefix(line, "#EXTINF:") {
+			seconds, err := strconv.ParseFloat(strings.SplitN(line[len("#EXTINF:"):], ",", 2)[0], 64)
+			if err == nil {
+				p.duration += time.Duration(seconds * float64(time.Second))
+			}
+		} else if strings.HasPrefix(line, "#EXT-X-KEY:") && !strings.Contains(line, "METHOD=NONE") {
+			return nil, errEncrypted
+		} else if !strings.HasPrefix(line, "#") {
+			ref, err := url.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+
+			uri := base.ResolveReference(ref)
+			if ref.RawQuery == "" {
+				// segments need the same auth token as the playlist
+				uri.RawQuery = base.RawQuery
+			}
+
+			if bandwidth >= 0 {
+				p.variants = append(p.variants, variant{bandwidth, uri.String()})
+				bandwidth = -1
+			} else {
+				p.segments = append(p.segments, uri.String())
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if first {
+		return nil, errors.New("download: empty playlist")
+	}
+
+	return p, nil
+}
+
+// mediaPlaylist fetches the playlist of segments to download, which is the
+// highest bandwidth variant of a master playlist
+func (d *Download) mediaPlaylist() (*playlist, error) {
+	p, err := d.getPlaylist(d.dl.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.variants) > 0 {
+		best := p.variants[0]
+		for _, v := range p.variants[1:] {
+			if v.bandwidth > best.bandwidth {
+				best = v
+			}
+		}
+
+		return d.getPlaylist(best.uri)
+	}
+
+	return p, nil
+}
+
+// fetchHls downloads every segment of the highest bandwidth variant into the
+// part file, one after another, recording each completed segment so that
+// the download may resume from the next one
+func (d *Download) fetchHls() error {
+	p, err := d.mediaPlaylist()
+	if err != nil {
+		return err
+	}
+
+	if len(p.segments) == 0 {
+		return errors.New("download: playlist has no segments")
+	}
+
+	d.stateMu.Lock()
+	if d.state == nil || d.state.Size != int64(len(p.segments)) {
+		d.state = &state{
+			Url:      stripQuery(d.dl.url),
+			Size:     int64(len(p.segments)),
+			Duration: p.duration.Seconds(),
+		}
+	}
+	d.stateMu.Unlock()
+
+	f, err := os.OpenFile(d.partFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// discard anything written after the last completed segment
+	if err := f.Truncate(d.state.Offset); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(d.state.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&d.current, d.state.Offset)
+
+	if err := d.saveState(); err != nil {
+		return err
+	}
+
+	for i := d.state.Segments; i < len(p.segments); i++ {
+		n, err := d.fetchSegment(f, p.segments[i])
+		if err != nil {
+			return err
+		}
+
+		d.stateMu.Lock()
+		d.state.Segments = i + 1
+		d.state.Offset += n
+		d.stateMu.Unlock()
+
+		if err := d.saveState(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Download) fetchSegment(w io.Writer, uri string) (int64, error) {
+	res, err := d.dl.client().Get(uri)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, &StatusError{res.StatusCode, uri}
+	}
+
+	return io.Copy(w, &countingReader{&limitedReader{res.Body, d.dl.Limiter}, d.received})
+}
+
+type countingReader struct {
+	r    io.Reader
+	Func func(int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.Func(n)
+	}
+	return n, err
+}
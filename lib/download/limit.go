@@ -0,0 +1,111 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.ssttevee.com/funimation/lib/rate"
+)
+
+// Window is a daily period of time, as offsets from midnight local time. A
+// window may wrap past midnight, like 23:00-02:00.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow parses a window written as "HH:MM-HH:MM"
+func ParseWindow(s string) (Window, error) {
+	startEnd := strings.Split(s, "-")
+	if len(startEnd) != 2 {
+		return Window{}, errors.New("download: window must look like HH:MM-HH:MM")
+	}
+
+	start, err := parseClock(startEnd[0])
+	if err != nil {
+		return Window{}, err
+	}
+
+	end, err := parseClock(startEnd[1])
+	if err != nil {
+		return Window{}, err
+	}
+
+	return Window{start, end}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("download: bad time of day %q", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) Contains(t time.Time) bool {
+	hour, min, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	return offset >= w.Start || offset < w.End
+}
+
+// Limiter limits the combined speed of every download it is given to. The
+// limit is lifted during any of its full speed windows.
+type Limiter struct {
+	// FullSpeed are the windows during which downloads are not limited
+	FullSpeed []Window
+
+	bucket *rate.Bucket
+}
+
+// NewLimiter returns a limiter that allows bytesPerSecond, or any speed if
+// bytesPerSecond is 0
+func NewLimiter(bytesPerSecond int64, fullSpeed ...Window) *Limiter {
+	burst := bytesPerSecond / 4
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+
+	return &Limiter{
+		FullSpeed: fullSpeed,
+		bucket:    rate.NewBucket(float64(bytesPerSecond), int(burst)),
+	}
+}
+
+// Wait blocks until n more bytes may be received
+func (l *Limiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, w := range l.FullSpeed {
+		if w.Contains(now) {
+			return
+		}
+	}
+
+	l.bucket.Wait(n)
+}
+
+type limitedReader struct {
+	r       io.Reader
+	limiter *Limiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if n > 0 {
+		l.limiter.Wait(n)
+	}
+
+	return n, err
+}
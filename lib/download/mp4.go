@@ -0,0 +1,128 @@
+package download
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type box struct {
+	typ    string
+	offset int64 // of the box's content
+	size   int64 // of the box's content
+}
+
+// readBoxes reads the headers of the boxes between start and end, checking
+// that they exactly fill the space
+func readBoxes(r io.ReaderAt, start, end int64) ([]box, error) {
+	var boxes []box
+
+	header := make([]byte, 16)
+	for offset := start; offset < end; {
+		if end-offset < 8 {
+			return nil, fmt.Errorf("mp4: %d trailing bytes at offset %d", end-offset, offset)
+		}
+
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("mp4: reading box header at offset %d: %v", offset, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+
+		switch size {
+		case 0:
+			// extends to the end
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("mp4: reading box header at offset %d: %v", offset, err)
+			}
+
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+
+		if size < headerLen || offset+size > end {
+			return nil, fmt.Errorf("mp4: %q box at offset %d has bad size %d", typ, offset, size)
+		}
+
+		boxes = append(boxes, box{typ, offset + headerLen, size - headerLen})
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+func findBox(boxes []box, typ string) (box, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+
+	return box{}, false
+}
+
+// mp4Duration checks the top level box structure of an mp4 file and returns
+// the duration found in its movie header
+func mp4Duration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	boxes, err := readBoxes(f, 0, fi.Size())
+	if err != nil {
+		return 0, err
+	}
+
+	moov, ok := findBox(boxes, "moov")
+	if !ok {
+		return 0, errors.New("mp4: moov box not found")
+	}
+
+	moovBoxes, err := readBoxes(f, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return 0, err
+	}
+
+	mvhd, ok := findBox(moovBoxes, "mvhd")
+	if !ok {
+		return 0, errors.New("mp4: mvhd box not found")
+	}
+
+	b := make([]byte, 32)
+	if mvhd.size < int64(len(b)) {
+		return 0, errors.New("mp4: mvhd box too short")
+	}
+
+	if _, err := f.ReadAt(b, mvhd.offset); err != nil {
+		return 0, err
+	}
+
+	var timescale, duration uint64
+	if b[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, errors.New("mp4: mvhd has zero timescale")
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
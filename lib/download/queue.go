@@ -0,0 +1,294 @@
+package download
+
+import (
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.ssttevee.com/funimation/lib/progress"
+)
+
+type JobStatus int
+
+const (
+	Queued JobStatus = iota
+	Downloading
+	Retrying
+	Done
+	Failed
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Downloading:
+		return "downloading"
+	case Retrying:
+		return "retrying"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	}
+
+	return "unknown"
+}
+
+type Job struct {
+	Name    string
+	Dest    string
+	Threads int
+
+	// Duration is how long the video is expected to be, if it is known
+	Duration time.Duration
+
+	// Url is called before every attempt to get the url to download from, so
+	// that it may be refreshed between retries
+	Url func() (string, error)
+
+	mu       sync.Mutex
+	status   JobStatus
+	attempts int
+	size     int64
+	download *Download
+	err      error
+}
+
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.status
+}
+
+// Attempts returns how many times the job has been started
+func (j *Job) Attempts() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.attempts
+}
+
+// Err returns the error of the last failed attempt
+func (j *Job) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.err
+}
+
+func (j *Job) Size() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.size
+}
+
+func (j *Job) Current() int64 {
+	j.mu.Lock()
+	d := j.download
+	j.mu.Unlock()
+
+	if d == nil {
+		return 0
+	}
+
+	return d.Current()
+}
+
+func (j *Job) Percent() float32 {
+	j.mu.Lock()
+	d, status := j.download, j.status
+	j.mu.Unlock()
+
+	if status == Done {
+		return 1
+	} else if d == nil {
+		return 0
+	}
+
+	return d.Percent()
+}
+
+func (j *Job) setStatus(status JobStatus, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status = status
+	j.err = err
+}
+
+type Queue struct {
+	// Concurrency is the number of jobs that may run at the same time
+	Concurrency int
+
+	// Retries is the number of times a failed job is attempted again
+	Retries int
+
+	// Backoff is how long to wait before the first retry of a job; it is
+	// doubled for every retry after that
+	Backoff time.Duration
+
+	Client *http.Client
+
+	// Limiter limits the combined speed of every job
+	Limiter *Limiter
+
+	// Verify enables checking each completed file with Download.Verify
+	Verify bool
+
+	// TempDir is where partial downloads are kept; defaults to the system's
+	// temp directory
+	TempDir string
+
+	// Quarantine is the directory that files failing verification are moved
+	// to before they are retried; defaults to a directory in TempDir
+	Quarantine string
+
+	// Progress receives the events of every job
+	Progress progress.Reporter
+
+	jobs []*Job
+}
+
+func NewQueue(concurrency int) *Queue {
+	return &Queue{
+		Concurrency: concurrency,
+		Retries:     3,
+		Backoff:     time.Second,
+		Client:      http.DefaultClient,
+		Progress:    progress.Discard,
+		Verify:      true,
+	}
+}
+
+func (q *Queue) Add(job *Job) {
+	q.jobs = append(q.jobs, job)
+}
+
+func (q *Queue) Jobs() []*Job {
+	return q.jobs
+}
+
+// Run downloads every job in the queue and blocks until they have all
+// either completed or run out of retries. It returns the failed jobs.
+func (q *Queue) Run() []*Job {
+	concurrency := q.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobs := make(chan *Job)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				q.run(job)
+			}
+		}()
+	}
+
+	for _, job := range q.jobs {
+		jobs <- job
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	var failed []*Job
+	for _, job := range q.jobs {
+		if job.Status() == Failed {
+			failed = append(failed, job)
+		}
+	}
+
+	return failed
+}
+
+func (q *Queue) run(job *Job) {
+	backoff := q.Backoff
+	for {
+		err := q.attempt(job)
+		if err == nil {
+			job.setStatus(Done, nil)
+			q.Progress.Finished(job.Name, job.Current())
+			return
+		}
+
+		if job.Attempts() > q.Retries {
+			job.setStatus(Failed, err)
+			q.Progress.Failed(job.Name, err, false)
+			return
+		}
+
+		job.setStatus(Retrying, err)
+		q.Progress.Failed(job.Name, err, true)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (q *Queue) attempt(job *Job) error {
+	job.mu.Lock()
+	job.attempts++
+	job.status = Downloading
+	job.mu.Unlock()
+
+	url, err := job.Url()
+	if err != nil {
+		return err
+	}
+
+	dl, err := NewWithClient(q.Client, url)
+	if err != nil {
+		return err
+	}
+
+	dl.Limiter = q.Limiter
+	dl.TempDir = q.TempDir
+	dl.OnBytesReceived = func(int) {
+		q.Progress.Bytes(job.Name, job.Current(), dl.Size())
+	}
+
+	q.Progress.Started(job.Name, job.Attempts(), dl.Size())
+
+	d, err := dl.Download(job.Dest, job.Threads)
+	if err != nil {
+		return err
+	}
+
+	job.mu.Lock()
+	job.size = dl.Size()
+	job.download = d
+	job.mu.Unlock()
+
+	if err := d.Wait(); err != nil {
+		return err
+	}
+
+	if !q.Verify {
+		return nil
+	}
+
+	if err := d.Verify(job.Duration); err != nil {
+		if _, ok := err.(*VerifyError); ok {
+			dir := q.Quarantine
+			if dir == "" {
+				dir = filepath.Join(dl.tempDir(), "quarantine")
+			}
+
+			if qerr := quarantine(job.Dest, dir, job.Attempts()); qerr != nil {
+				return qerr
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package download
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VerifyError means a completed download is not a complete, playable file
+type VerifyError struct {
+	Path   string
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("download: %s failed verification: %s", e.Path, e.Reason)
+}
+
+// Verify checks that a completed download is whole. The file size is
+// checked against the size announced by the server, hls streams against the
+// playlist they were downloaded from and the packets of an mpeg transport
+// stream, and mp4 files are parsed to check their structure. If duration is
+// not 0, the duration of an mp4 file or hls playlist must also be close to
+// it.
+func (d *Download) Verify(duration time.Duration) error {
+	fi, err := os.Stat(d.dest)
+	if err != nil {
+		return err
+	}
+
+	if d.dl.hls {
+		return d.verifyHls(fi.Size(), duration)
+	}
+
+	if d.size > 0 && fi.Size() != d.size {
+		return &VerifyError{d.dest, fmt.Sprintf("got %d bytes, expected %d", fi.Size(), d.size)}
+	}
+
+	if !strings.EqualFold(filepath.Ext(d.dest), ".mp4") {
+		return nil
+	}
+
+	actual, err := mp4Duration(d.dest)
+	if err != nil {
+		return &VerifyError{d.dest, err.Error()}
+	}
+
+	if duration > 0 && !durationPlausible(actual, duration) {
+		return &VerifyError{d.dest, fmt.Sprintf("duration is %v, expected %v", actual, duration)}
+	}
+
+	return nil
+}
+
+// tsPacketSize is the size of every packet of an mpeg transport stream,
+// each of which starts with a sync byte
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+)
+
+func (d *Download) verifyHls(size int64, duration time.Duration) error {
+	// the state of the download is kept after it completes, with what the
+	// playlist said when the download started
+	d.stateMu.Lock()
+	segments, total, offset := d.state.Segments, d.state.Size, d.state.Offset
+	playlistDuration := time.Duration(d.state.Duration * float64(time.Second))
+	d.stateMu.Unlock()
+
+	if int64(segments) != total {
+		return &VerifyError{d.dest, fmt.Sprintf("got %d segments, expected %d", segments, total)}
+	}
+
+	if duration > 0 && playlistDuration > 0 && !durationPlausible(playlistDuration, duration) {
+		return &VerifyError{d.dest, fmt.Sprintf("playlist is %v long, expected %v", playlistDuration, duration)}
+	}
+
+	if size != offset {
+		return &VerifyError{d.dest, fmt.Sprintf("got %d bytes, expected %d", size, offset)}
+	}
+
+	if size == 0 || size%tsPacketSize != 0 {
+		return &VerifyError{d.dest, fmt.Sprintf("got %d bytes, which is not a whole number of transport stream packets", size)}
+	}
+
+	f, err := os.Open(d.dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	packet := make([]byte, tsPacketSize)
+	for n := 0; ; n++ {
+		if _, err := io.ReadFull(r, packet); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if packet[0] != tsSyncByte {
+			return &VerifyError{d.dest, fmt.Sprintf("transport stream packet %d has no sync byte", n)}
+		}
+	}
+}
+
+// durationPlausible allows some leeway since the expected duration is
+// rounded and may not count the same frames
+func durationPlausible(actual, expected time.Duration) bool {
+	leeway := expected / 20
+	if leeway < 5*time.Second {
+		leeway = 5 * time.Second
+	}
+
+	diff := actual - expected
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= leeway
+}
+
+// quarantine moves a file that failed verification into dir so that it
+// does not pass for a good download, but may still be inspected
+func quarantine(path, dir string, attempt int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	return moveFile(path, filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(path), attempt)))
+}
@@ -0,0 +1,398 @@
+package funimation
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Series, Episode and Asset are encoded as the structs below, whose field
+// names must not change so that values encoded by older versions can still
+// be decoded. Decoded series and episodes have no client, and must be given
+// one with Attach before they can fetch anything.
+
+type assetData struct {
+	PlayerId string                         `json:"playerId,omitempty"`
+	Kind     AssetKind                      `json:"kind"`
+	Type     EpisodeType                    `json:"type,omitempty"`
+	Season   int                            `json:"season"`
+	Number   float32                        `json:"number"`
+	Title    string                         `json:"title"`
+	Summary  string                         `json:"summary,omitempty"`
+	Videos   map[EpisodeLanguage]*videoData `json:"videos"`
+
+	// Page is the url of the page the asset was found on, to refresh it from
+	Page string `json:"page,omitempty"`
+
+	// AuthToken is only read, from values encoded before each video had a
+	// token of its own
+	AuthToken string `json:"authToken,omitempty"`
+}
+
+type videoData struct {
+	FunimationId string  `json:"funimationId,omitempty"`
+	AuthToken    string  `json:"authToken,omitempty"`
+	Duration     float64 `json:"duration,omitempty"`
+
+	// Urls are keyed by the name of their quality, like "720p"
+	Urls map[string]string `json:"urls"`
+
+	// Renditions are the other videos in the same language, if there are any
+	Renditions []*videoData `json:"renditions,omitempty"`
+}
+
+func renditionData(r *Rendition) *videoData {
+	v := &videoData{
+		FunimationId: r.funimationId,
+		AuthToken:    r.authToken,
+		Duration:     r.duration.Seconds(),
+		Urls:         make(map[string]string),
+	}
+
+	for quality, url := range r.urls {
+		v.Urls[quality.String()] = url
+	}
+
+	return v
+}
+
+func (v *videoData) rendition(authToken string) *Rendition {
+	r := &Rendition{
+		funimationId: v.FunimationId,
+		authToken:    v.AuthToken,
+		duration:     time.Duration(v.Duration * float64(time.Second)),
+		urls:         make(map[EpisodeQuality]string),
+	}
+
+	if r.authToken == "" {
+		r.authToken = authToken
+	}
+
+	for quality, url := range v.Urls {
+		r.urls[ParseEpisodeQuality(quality)] = url
+	}
+
+	return r
+}
+
+type episodeData struct {
+	Season       int         `json:"season"`
+	Number       float32     `json:"number"`
+	Type         EpisodeType `json:"type"`
+	Title        string      `json:"title"`
+	Summary      string      `json:"summary,omitempty"`
+	Url          string      `json:"url"`
+	ThumbnailUrl string      `json:"thumbnailUrl,omitempty"`
+	Badges       []string    `json:"badges,omitempty"`
+
+	// Assets starts with the video of the episode itself
+	Assets []*Asset `json:"assets,omitempty"`
+}
+
+type seriesData struct {
+	ShowId      int                     `json:"showId"`
+	Slug        string                  `json:"slug"`
+	Title       string                  `json:"title"`
+	Description string                  `json:"description,omitempty"`
+	PosterUrl   string                  `json:"posterUrl,omitempty"`
+	Episodes    EpisodeList             `json:"episodes,omitempty"`
+	Assets      map[AssetKind]AssetList `json:"assets,omitempty"`
+}
+
+func (a *Asset) data() *assetData {
+	d := &assetData{
+		PlayerId: a.playerId,
+		Kind:     a.kind,
+		Type:     a.episodeType,
+		Season:   a.seasonNum,
+		Number:   a.number,
+		Title:    a.title,
+		Summary:  a.summary,
+		Videos:   make(map[EpisodeLanguage]*videoData),
+	}
+
+	if a.episode != nil {
+		d.Page = a.episode.pageUrl()
+	}
+
+	for lang, urls := range a.videoUrls {
+		v := renditionData(&Rendition{
+			funimationId: a.funIds[lang],
+			authToken:    a.authTokens[lang],
+			duration:     a.durations[lang],
+			urls:         urls,
+		})
+
+		if renditions := a.renditions[lang]; len(renditions) > 1 {
+			for _, r := range renditions[1:] {
+				v.Renditions = append(v.Renditions, renditionData(r))
+			}
+		}
+
+		d.Videos[lang] = v
+	}
+
+	return d
+}
+
+func (a *Asset) setData(d *assetData) {
+	a.playerId = d.PlayerId
+	a.kind = d.Kind
+	a.episodeType = d.Type
+	a.seasonNum = d.Season
+	a.number = d.Number
+	a.title = d.Title
+	a.summary = d.Summary
+
+	// a page of its own until it is linked to the episode that has it
+	a.episode = nil
+	if d.Page != "" {
+		a.episode = &Episode{url: d.Page}
+	}
+
+	a.videoUrls = make(map[EpisodeLanguage]map[EpisodeQuality]string)
+	a.funIds = make(map[EpisodeLanguage]string)
+	a.authTokens = make(map[EpisodeLanguage]string)
+	a.durations = make(map[EpisodeLanguage]time.Duration)
+	a.renditions = make(map[EpisodeLanguage][]*Rendition)
+
+	for lang, v := range d.Videos {
+		a.addRendition(lang, v.rendition(d.AuthToken))
+		for _, other := range v.Renditions {
+			a.addRendition(lang, other.rendition(d.AuthToken))
+		}
+	}
+}
+
+func (a *Asset) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.data())
+}
+
+func (a *Asset) UnmarshalJSON(b []byte) error {
+	var d assetData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	a.setData(&d)
+
+	return nil
+}
+
+func (a *Asset) GobEncode() ([]byte, error) {
+	return gobEncode(a.data())
+}
+
+func (a *Asset) GobDecode(b []byte) error {
+	var d assetData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&d); err != nil {
+		return err
+	}
+
+	a.setData(&d)
+
+	return nil
+}
+
+func (e *Episode) data() *episodeData {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return &episodeData{
+		Season:       e.seasonNum,
+		Number:       e.episodeNum,
+		Type:         e.episodeType,
+		Title:        e.title,
+		Summary:      e.summary,
+		Url:          e.url,
+		ThumbnailUrl: e.thumbnailUrl,
+		Badges:       e.badges,
+		Assets:       e.assets,
+	}
+}
+
+func (e *Episode) setData(d *episodeData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seasonNum = d.Season
+	e.episodeNum = d.Number
+	e.episodeType = d.Type
+	e.title = d.Title
+	e.summary = d.Summary
+	e.url = d.Url
+	e.thumbnailUrl = d.ThumbnailUrl
+	e.badges = d.Badges
+	e.assets = d.Assets
+	for _, a := range e.assets {
+		a.episode = e
+	}
+
+	e.video = nil
+	if len(e.assets) > 0 {
+		e.video = e.assets[0]
+	}
+}
+
+func (e *Episode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.data())
+}
+
+func (e *Episode) UnmarshalJSON(b []byte) error {
+	var d episodeData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	e.setData(&d)
+
+	return nil
+}
+
+func (e *Episode) GobEncode() ([]byte, error) {
+	return gobEncode(e.data())
+}
+
+func (e *Episode) GobDecode(b []byte) error {
+	var d episodeData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&d); err != nil {
+		return err
+	}
+
+	e.setData(&d)
+
+	return nil
+}
+
+// Attach makes a decoded episode fetch with the given client
+func (e *Episode) Attach(client *Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.client = client
+}
+
+// Attach makes every decoded episode in the list fetch with the given client
+func (l EpisodeList) Attach(client *Client) {
+	for _, ep := range l {
+		ep.Attach(client)
+	}
+}
+
+// Attach makes a decoded video fetch its page with the given client, to
+// refresh or guess its urls from. Videos that were encoded without a page
+// have nothing to fetch.
+func (a *Asset) Attach(client *Client) {
+	if a.episode != nil {
+		a.episode.Attach(client)
+	}
+}
+
+// Attach makes every decoded video in the list fetch with the given client
+func (l AssetList) Attach(client *Client) {
+	for _, a := range l {
+		a.Attach(client)
+	}
+}
+
+func (s *Series) data() *seriesData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &seriesData{
+		ShowId:      s.showId,
+		Slug:        s.slug,
+		Title:       s.name,
+		Description: s.description,
+		PosterUrl:   s.posterUrl,
+		Episodes:    s.episodes,
+		Assets:      s.assets,
+	}
+}
+
+func (s *Series) setData(d *seriesData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.showId = d.ShowId
+	s.slug = d.Slug
+	s.name = d.Title
+	s.description = d.Description
+	s.posterUrl = d.PosterUrl
+	s.episodes = d.Episodes
+	s.assets = d.Assets
+}
+
+func (s *Series) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.data())
+}
+
+func (s *Series) UnmarshalJSON(b []byte) error {
+	var d seriesData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+
+	s.setData(&d)
+
+	return nil
+}
+
+func (s *Series) GobEncode() ([]byte, error) {
+	return gobEncode(s.data())
+}
+
+func (s *Series) GobDecode(b []byte) error {
+	var d seriesData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&d); err != nil {
+		return err
+	}
+
+	s.setData(&d)
+
+	return nil
+}
+
+// Attach makes a decoded series, and the episodes and other videos it has
+// already listed, fetch with the given client. Listed videos of its episodes
+// are replaced by the ones the episodes have.
+func (s *Series) Attach(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+	s.episodes.Attach(client)
+
+	type key struct{ page, playerId string }
+
+	held := make(map[key]*Asset)
+	for _, ep := range s.episodes {
+		for _, a := range ep.Assets() {
+			held[key{ep.pageUrl(), a.playerId}] = a
+		}
+	}
+
+	for _, assets := range s.assets {
+		for i, a := range assets {
+			if a.episode == nil {
+				continue
+			}
+
+			if h, ok := held[key{a.episode.pageUrl(), a.playerId}]; ok {
+				assets[i] = h
+			} else {
+				a.Attach(client)
+			}
+		}
+	}
+}
+
+func gobEncode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,308 @@
+package funimation
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSeries(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"showId", "slug", "title", "episodes"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("missing %s in %s", field, b)
+		}
+	}
+
+	var decoded Series
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded.Attach(NewWithHttpClient(client.httpClient))
+
+	if decoded.ShowId() != series.ShowId() || decoded.Title() != series.Title() {
+		t.Errorf("got show %d %q, want %d %q", decoded.ShowId(), decoded.Title(), series.ShowId(), series.Title())
+	}
+
+	got, err := decoded.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareEpisodes(t, got, episodes)
+
+	// a decoded episode can still fetch its page
+	ep, err := decoded.GetEpisodeBySlug("MS-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ep.Title() != episodes[0].Title() {
+		t.Errorf("got %q, want %q", ep.Title(), episodes[0].Title())
+	}
+}
+
+func TestEncodeEpisodeList(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(episodes); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded EpisodeList
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	compareEpisodes(t, decoded, episodes)
+
+	// not collected, so GuessVideoUrl has to fetch the page with the
+	// attached client
+	lazy := &Episode{url: episodes[0].url}
+	b, err := json.Marshal(lazy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rehydrated Episode
+	if err := json.Unmarshal(b, &rehydrated); err != nil {
+		t.Fatal(err)
+	}
+
+	rehydrated.Attach(client)
+
+	if _, err := rehydrated.GuessVideoUrl(Subbed, StandardDefinition); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func compareEpisodes(t *testing.T, got, want EpisodeList) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d episodes, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i].data().Url != want[i].data().Url || got[i].Title() != want[i].Title() || got[i].Type() != want[i].Type() || got[i].EpisodeNumber() != want[i].EpisodeNumber() {
+			t.Errorf("episode %d: got %+v, want %+v", i, got[i].data(), want[i].data())
+		}
+
+		if !reflect.DeepEqual(got[i].Video().data(), want[i].Video().data()) {
+			t.Errorf("episode %d: got video %+v, want %+v", i, got[i].Video().data(), want[i].Video().data())
+		}
+
+		for _, lang := range want[i].Languages() {
+			wantUrl, wantErr := want[i].GetVideoUrl(lang, StandardDefinition)
+			gotUrl, gotErr := got[i].GetVideoUrl(lang, StandardDefinition)
+			if gotUrl != wantUrl || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("episode %d %s: got url %q, %v, want %q, %v", i, lang, gotUrl, gotErr, wantUrl, wantErr)
+			}
+		}
+	}
+}
+
+func TestEncodeEpisodeWithoutAssets(t *testing.T) {
+	ep := &Episode{title: "Lost", url: "http://www.funimation.com/shows/multi-season/videos/official/lost"}
+
+	b, err := json.Marshal(ep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJson Episode
+	if err := json.Unmarshal(b, &fromJson); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	var fromGob Episode
+	if err := gob.NewDecoder(&buf).Decode(&fromGob); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, decoded := range []*Episode{&fromJson, &fromGob} {
+		if decoded.Title() != "Lost" || decoded.Video() != nil {
+			t.Errorf("got %q with video %v", decoded.Title(), decoded.Video())
+		}
+
+		if len(decoded.Languages()) != 0 || len(decoded.Qualities(Subbed)) != 0 || decoded.Duration(Subbed) != 0 {
+			t.Error("got languages, qualities or a duration without a video")
+		}
+
+		if decoded.GetBestQuality(Subbed, false) != NoQuality {
+			t.Error("got a best quality without a video")
+		}
+
+		if _, err := decoded.GetVideoUrl(Subbed, StandardDefinition); err == nil {
+			t.Error("expected an error getting the url of no video")
+		}
+
+		// there is no client to fetch the page with
+		if _, err := decoded.GuessVideoUrl(Subbed, StandardDefinition); err == nil {
+			t.Error("expected an error guessing the url of no video")
+		}
+
+		if s := (EpisodeList{decoded}).String(); !strings.Contains(s, "Lost") {
+			t.Errorf("got listing %q", s)
+		}
+	}
+}
+
+func TestEncodeSeriesAssets(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	for _, test := range []struct {
+		show string
+		kind AssetKind
+	}{
+		{"multi-season", EpisodeAsset},
+		{"extras", TrailerAsset},
+	} {
+		series, err := client.GetSeries(test.show)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.kind == EpisodeAsset {
+			if _, err := series.GetAllEpisodes(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		assets, err := series.GetAssets(test.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(series); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Series
+		if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded.Attach(NewWithHttpClient(client.httpClient))
+
+		got, err := decoded.GetAssets(test.kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != len(assets) {
+			t.Fatalf("%s: got %d %ss, want %d", test.show, len(got), test.kind, len(assets))
+		}
+
+		if test.kind == EpisodeAsset {
+			episodes, _ := decoded.GetAllEpisodes()
+			for i, a := range got {
+				if a != episodes[i].Video() {
+					t.Errorf("%s: %s %d is not the video of its episode", test.show, test.kind, i)
+				}
+			}
+		}
+
+		for _, a := range got {
+			fresh, err := a.Refresh()
+			if err != nil {
+				t.Fatalf("%s: %s: %v", test.show, a.Title(), err)
+			}
+
+			if fresh.Title() != a.Title() || fresh.Kind() != test.kind {
+				t.Errorf("%s: refreshed %q into %s %q", test.show, a.Title(), fresh.Kind(), fresh.Title())
+			}
+
+			if av := a.CheckAvailability(); len(av) == 0 || !av[0].Available() {
+				t.Errorf("%s: %s can't be probed after decoding", test.show, a.Title())
+			}
+		}
+	}
+}
+
+func TestEncodeAssetList(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("extras")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailers, err := series.GetTrailers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(trailers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded AssetList
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decoded[0].Refresh(); err == nil {
+		t.Error("expected an error refreshing without a client")
+	}
+
+	decoded.Attach(NewWithHttpClient(client.httpClient))
+
+	for i, a := range decoded {
+		fresh, err := a.Refresh()
+		if err != nil {
+			t.Fatalf("%s: %v", a.Title(), err)
+		}
+
+		if fresh.Title() != trailers[i].Title() || fresh.Kind() != TrailerAsset {
+			t.Errorf("refreshed %q into %s %q", trailers[i].Title(), fresh.Kind(), fresh.Title())
+		}
+
+		if _, err := a.GuessVideoUrl(Subbed, StandardDefinition); err != nil {
+			t.Errorf("%s: %v", a.Title(), err)
+		}
+	}
+}
@@ -2,11 +2,11 @@ package funimation
 
 import (
 	"errors"
-	"net/http"
 	"strings"
-	"strconv"
 	"bytes"
 	"fmt"
+	"sync"
+	"time"
 )
 
 type EpisodeLanguage string
@@ -54,9 +54,65 @@ const (
 	Regular EpisodeType = "Episode"
 	Ova                 = "OVA"
 	Special             = "Special"
+	Movie               = "Movie"
+	Recap               = "Recap"
+	Preview             = "Preview"
+	Extra               = "Extra"
 )
 
+// itemClass is what an item class or video type of the website makes an
+// episode, and the video on its page
+type itemClass struct {
+	typ  EpisodeType
+	kind AssetKind
+}
+
+// itemClasses are the item classes and video types that are known. Both the
+// type of an episode and the kind of its video are read from here, so that
+// they always agree. The website also has a "recap" class, but it puts it on
+// regular episodes, so it is left out.
+var itemClasses = map[string]itemClass{
+	"episode":  {Regular, EpisodeAsset},
+	"ova":      {Ova, EpisodeAsset},
+	"special":  {Special, EpisodeAsset},
+	"specials": {Special, EpisodeAsset},
+	"movie":    {Movie, MovieAsset},
+	"feature":  {Movie, MovieAsset},
+	"preview":  {Preview, TrailerAsset},
+	"trailer":  {Preview, TrailerAsset},
+	"clip":     {Extra, ClipAsset},
+	"extra":    {Extra, ExtraAsset},
+	"extras":   {Extra, ExtraAsset},
+	"bonus":    {Extra, ExtraAsset},
+}
+
+// lookupItemClass finds the first of the classes that is known
+func lookupItemClass(classes ...string) (itemClass, bool) {
+	for _, class := range classes {
+		if c, ok := itemClasses[strings.ToLower(class)]; ok {
+			return c, true
+		}
+	}
+
+	return itemClass{}, false
+}
+
+// parseEpisodeType reads the type of a playlist item from its item class,
+// or from its video type if the class is not one of ours. It is empty if
+// neither says.
+func parseEpisodeType(itemClass, videoType string) EpisodeType {
+	if c, ok := lookupItemClass(itemClass, videoType); ok {
+		return c.typ
+	}
+
+	return ""
+}
+
+// Episode is safe for concurrent use. Its data is collected before it is
+// returned, except for GuessVideoUrl which may collect it on first use.
 type Episode struct {
+	mu sync.RWMutex
+
 	seasonNum   int
 	episodeNum  float32
 	episodeType EpisodeType
@@ -64,264 +120,256 @@ type Episode struct {
 	title       string
 	summary     string
 
-	videoUrls   map[EpisodeLanguage]map[EpisodeQuality]string
-
 	url         string
 
-	funIds      map[EpisodeLanguage]string
-	authToken   string
-	client      *http.Client
+	// from the show's listing, if found through one
+	thumbnailUrl string
+	badges       []string
+
+	// the video of the episode itself and every video on its page
+	video       *Asset
+	assets      []*Asset
+
+	client      *Client
 }
 
 func (e *Episode) SeasonNumber() (int) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.seasonNum
 }
 
 func (e *Episode) EpisodeNumber() (float32) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.episodeNum
 }
 
 func (e *Episode) Type() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return string(e.episodeType)
 }
 
 func (e *Episode) TypeCode() string {
-	if e.episodeType == Ova {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	switch e.episodeType {
+	case Ova:
 		return "o"
-	} else if e.episodeType == Special {
+	case Special:
 		return "special"
+	case Movie:
+		return "m"
+	case Recap:
+		return "r"
+	case Preview:
+		return "p"
+	case Extra:
+		return "x"
 	}
 
 	return "e"
 }
 
+func (e *Episode) pageUrl() (string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.url
+}
+
+func (e *Episode) getClient() (*Client) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.client
+}
+
 func (e *Episode) Title() (string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.title
 }
 
 func (e *Episode) Summary() (string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.summary
 }
 
-func (e *Episode) Languages() ([]EpisodeLanguage) {
-	langs := make([]EpisodeLanguage, 0, len(e.videoUrls))
+// ThumbnailUrl returns the episode's thumbnail on the show's listing, or an
+// empty string if it wasn't found through one
+func (e *Episode) ThumbnailUrl() (string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	for lang, _ := range e.videoUrls {
-		langs = append(langs, lang)
-	}
-
-	return langs
+	return e.thumbnailUrl
 }
 
-func (e *Episode) Qualities(lang EpisodeLanguage) ([]EpisodeQuality) {
-	urls := e.videoUrls[lang]
-	qualities := make([]EpisodeQuality, 0, len(urls))
+// Badges returns the availability badges on the show's listing, like "SUB",
+// "DUB" or "HD"
+func (e *Episode) Badges() ([]string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	for quality, _ := range urls {
-		qualities = append(qualities, quality)
-	}
-
-	return qualities
+	return e.badges
 }
 
-func (e *Episode) GetVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
-	if urls, ok := e.videoUrls[lang]; ok {
-		if url, ok := urls[quality]; ok {
-			if url == "subscriptionLoggedOut" {
-				return "", errors.New("This video is members only")
-			} else if url == "matureContentLoggedOut" {
-				return "", errors.New("This video is members only and you must be at least 17")
-			} else if url == "nonSubscription" {
-				return "", errors.New("This video is only available to subscribers")
-			} else if url == "matureContentLoggedIn" {
-				return "", errors.New("You must be at least 17")
-			} else if url == "territoryUnavailable" {
-				return "", errors.New("This video is not available in your territory")
-			}
-
-			return url, nil
-		}
-	}
+// Video returns the video of the episode itself
+func (e *Episode) Video() (*Asset) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	return "", errors.New("No videos found with the given language and quality")
+	return e.video
 }
 
-func (e *Episode) GuessVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
-	funId, err := e.getFunimationId(lang)
-	if err != nil {
-		return "", err
-	}
+// Assets returns every video on the episode's page, starting with the
+// episode itself and followed by any trailers, extras or alternate cuts
+func (e *Episode) Assets() ([]*Asset) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	if e.authToken == "" {
-		return "", errors.New("Couldn't find auth token")
-	}
+	return e.assets
+}
 
-	if quality == NoQuality {
-		return "", errors.New("Quality cannot be none")
-	}
+// errNoVideo is returned for an episode that was decoded without its videos
+var errNoVideo = errors.New("episode: no video")
 
-	bitrate := 1500
-	switch quality {
-	case HighDefinition:
-		bitrate = 2500
-	case FullHighDefinition:
-		bitrate = 4000
+func (e *Episode) Languages() ([]EpisodeLanguage) {
+	video := e.Video()
+	if video == nil {
+		return nil
 	}
 
-	return fmt.Sprintf("http://wpc.8c48.edgecastcdn.net/008C48/SV/480/%s/%s-480-%dK.mp4%s", funId, funId, bitrate, e.authToken), nil
+	return video.Languages()
 }
 
-func (e *Episode) getFunimationId(lang EpisodeLanguage) (string, error) {
-	if e.funIds != nil {
-		// if there's only one, just return that one regardless of what was requested
-		if len(e.funIds) == 1 {
-			for _, fid := range e.funIds {
-				return fid, nil
-			}
-		}
-		if fid, ok := e.funIds[lang]; ok {
-			return fid, nil
-		}
-		return "", errors.New("episode: lang not found")
-	}
-
-	err := e.collectData()
-	if err != nil {
-		return "", err
+// Duration returns the length of the video in the given language, or 0 if it
+// is not known
+func (e *Episode) Duration(lang EpisodeLanguage) (time.Duration) {
+	video := e.Video()
+	if video == nil {
+		return 0
 	}
 
-	return e.getFunimationId(lang)
+	return video.Duration(lang)
 }
 
-func (e *Episode) collectData() (error) {
-	playersData, err := getPlayersDataFromUrl(e.client, e.url)
-	if err != nil {
-		return err
+func (e *Episode) Qualities(lang EpisodeLanguage) ([]EpisodeQuality) {
+	video := e.Video()
+	if video == nil {
+		return nil
 	}
 
-	playerData := playersData[0]
-
-	e.funIds = make(map[EpisodeLanguage]string)
-	e.videoUrls = make(map[EpisodeLanguage]map[EpisodeQuality]string)
+	return video.Qualities(lang)
+}
 
-	found := false
-	for _, pli := range playerData.playlist {
-		err := e.handlePlaylistItem(pli)
-		if err == nil {
-			found = true
-		} else if err != NotFound {
-			return err
-		}
+func (e *Episode) GetVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
+	video := e.Video()
+	if video == nil {
+		return "", errNoVideo
 	}
 
-	if found {
-		return nil
-	} else {
-		return errors.New("episode: video set not found")
-	}
+	return video.GetVideoUrl(lang, quality)
 }
 
-func (e *Episode) handlePlaylistItem(pi playlistItem) (error) {
-	if clip, ok := pi.(*playlistItemClip); ok {
-		err := e.handlePlaylistItemClip(clip)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	} else if container, ok := pi.(*playlistItemContainer); ok {
-		found := false
-		for _, item := range container.items {
-			err := e.handlePlaylistItem(item)
-			if err == nil {
-				space := strings.LastIndex(container.title, " ")
-
-				seNum, err := strconv.ParseInt(container.title[space + 1:], 10, 32)
-				if err != nil {
-					return errors.New("episode: can't parse season number (\"" + container.title[space + 1:] + "\")")
-				}
-
-				e.seasonNum = int(seNum)
-
-				found = true
-			} else if err != NotFound {
-				return err
-			}
+func (e *Episode) GuessVideoUrl(lang EpisodeLanguage, quality EpisodeQuality) (string, error) {
+	if e.Video() == nil {
+		if err := e.collectData(); err != nil {
+			return "", err
 		}
+	}
 
-		if found {
-			return nil
-		} else {
-			return NotFound
-		}
+	video := e.Video()
+	if video == nil {
+		return "", errNoVideo
 	}
 
-	return NotFound
+	return video.GuessVideoUrl(lang, quality)
 }
 
-func (e *Episode) handlePlaylistItemClip(clip *playlistItemClip) (error) {
-	const dash = " - "
+// Refresh fetches the episode's page again, for video urls with a fresh auth
+// token
+func (e *Episode) Refresh() (error) {
+	return e.collectData()
+}
 
-	if clip.videoSet == nil || len(clip.videoSet) == 0 {
-		return NotFound
+func (e *Episode) GetBestQuality(el EpisodeLanguage, onlyAvailable bool) EpisodeQuality {
+	video := e.Video()
+	if video == nil {
+		return NoQuality
 	}
 
-	e.title = clip.title
+	return video.GetBestQuality(el, onlyAvailable)
+}
 
-	titleDash := strings.Index(e.title, dash)
-	if titleDash != -1 {
-		e.title = e.title[titleDash + len(dash):]
+func (e *Episode) collectData() (error) {
+	if e.getClient() == nil {
+		return errors.New("episode: no client to fetch with, attach one after decoding")
 	}
 
-	e.summary = clip.description
+	playersData, err := getPlayersDataFromUrl(e.getClient(), e.url)
+	if err != nil {
+		return err
+	}
 
-	for _, video := range clip.videoSet {
-		language := video.languageMode
+	if err := e.collectPlayersData(playersData); err != nil {
+		return err
+	}
 
-		// collect auth token
-		e.authToken = video.authToken
+	e.getClient().log().Debug("collected episode", "episode", e.url, "season", e.SeasonNumber(), "number", e.EpisodeNumber(), "title", e.Title(), "assets", len(e.Assets()))
 
-		// collect funimation id
-		e.funIds[language] = video.funimationId
+	return nil
+}
 
-		// collect video urls
-		urls := make(map[EpisodeQuality]string)
+// collectPlayersData makes an asset of every player's video. The first one
+// is taken to be the episode itself.
+func (e *Episode) collectPlayersData(playersData []*playerData) (error) {
+	if len(playersData) == 0 {
+		return errors.New("episode: no player found on page")
+	}
 
-		if video.sdUrl != "" {
-			urls[StandardDefinition] = video.sdUrl
-		}
-		if video.hdUrl != "" {
-			urls[HighDefinition] = video.hdUrl
-		}
-		if video.hd1080Url != "" {
-			urls[FullHighDefinition] = video.hd1080Url
+	var assets []*Asset
+	for _, playerData := range playersData {
+		asset, err := newAsset(playerData)
+		if err == NotFound {
+			continue
+		} else if err != nil {
+			return err
 		}
 
-		e.videoUrls[language] = urls
+		asset.episode = e
+		assets = append(assets, asset)
 	}
 
-	// collect episode number
-	e.episodeNum = clip.number
+	if len(assets) == 0 {
+		return errors.New("episode: video set not found")
+	}
 
-	return nil
-}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-func (e *Episode) GetBestQuality(el EpisodeLanguage, onlyAvailable bool) EpisodeQuality {
-	quality := NoQuality
+	e.assets = assets
+	e.video = assets[0]
 
-	if urls, ok := e.videoUrls[el]; ok {
-		for q, url := range urls {
-			if onlyAvailable && !strings.HasPrefix(url, "http") {
-				continue
-			}
-
-			if q > quality {
-				quality = q
-			}
-		}
+	e.seasonNum = e.video.seasonNum
+	e.episodeNum = e.video.number
+	if e.video.episodeType != "" {
+		e.episodeType = e.video.episodeType
+	} else if e.episodeType == "" {
+		e.episodeType = Regular
 	}
+	e.title = e.video.title
+	e.summary = e.video.summary
 
-	return quality
+	return nil
 }
 
 type EpisodeList []*Episode
@@ -331,11 +379,12 @@ func (e EpisodeList) String() (string) {
 
 	seasons := make(map[int]EpisodeList)
 	for _, ep := range e {
-		if _, ok := seasons[ep.seasonNum]; !ok {
-			seasons[ep.seasonNum] = make(EpisodeList, 0)
+		seasonNum := ep.SeasonNumber()
+		if _, ok := seasons[seasonNum]; !ok {
+			seasons[seasonNum] = make(EpisodeList, 0)
 		}
 
-		seasons[ep.seasonNum] = append(seasons[ep.seasonNum], ep)
+		seasons[seasonNum] = append(seasons[seasonNum], ep)
 	}
 
 	fmt.Fprintln(&buf, fmt.Sprintf("%d Seasons, %d Episodes", len(seasons), len(e)))
@@ -344,25 +393,14 @@ func (e EpisodeList) String() (string) {
 		fmt.Fprintf(&buf, "\nSeason %d:\n", seasonNum)
 
 		for _, ep := range episodes {
-			if ep.episodeNum == 0 {
-				fmt.Fprintf(&buf, "\t%s - %s\n", ep.episodeType, ep.title)
+			if ep.EpisodeNumber() == 0 {
+				fmt.Fprintf(&buf, "\t%s - %s\n", ep.Type(), ep.Title())
 			} else {
-				fmt.Fprintf(&buf, "\t%s %v - %s\n", ep.episodeType, ep.episodeNum, ep.title)
+				fmt.Fprintf(&buf, "\t%s %v - %s\n", ep.Type(), ep.EpisodeNumber(), ep.Title())
 			}
 
-			for lang := range ep.videoUrls {
-				fmt.Fprintf(&buf, "\t\t%sbed: ", lang)
-
-				if qs := ep.Qualities(lang); len(qs) > 0 {
-					qNames := make([]string, len(qs))
-					for i, q := range qs {
-						qNames[i] = q.String()
-					}
-
-					fmt.Fprintln(&buf, strings.Join(qNames, ", "))
-				} else {
-					fmt.Fprintln(&buf, NoQuality.String())
-				}
+			if video := ep.Video(); video != nil {
+				writeQualities(&buf, video)
 			}
 		}
 	}
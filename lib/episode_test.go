@@ -0,0 +1,129 @@
+package funimation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEpisodeTypeFixtures(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		typ      EpisodeType
+		typeCode string
+	}{
+		{"episode", Regular, "e"},
+		{"ova", Ova, "o"},
+		{"special", Special, "special"},
+		{"movie", Movie, "m"},
+		{"preview", Preview, "p"},
+		{"extra", Extra, "x"},
+		{"videotype", Ova, "o"},
+	}
+
+	for _, test := range tests {
+		b, err := os.ReadFile(filepath.Join("testdata", "playersdata", test.fixture+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		playersData, err := getPlayersData(b)
+		if err != nil {
+			t.Fatalf("%s: %v", test.fixture, err)
+		}
+
+		ep := &Episode{}
+		if err := ep.collectPlayersData(playersData); err != nil {
+			t.Fatalf("%s: %v", test.fixture, err)
+		}
+
+		if ep.Type() != string(test.typ) || ep.TypeCode() != test.typeCode {
+			t.Errorf("%s: got type %q with code %q, want %q with code %q", test.fixture, ep.Type(), ep.TypeCode(), test.typ, test.typeCode)
+		}
+	}
+}
+
+func TestEpisodeTypeFromListing(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("types")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]EpisodeType{
+		"A Special Day":    Regular,
+		"The OVA":          Ova,
+		"The Special":      Special,
+		"Next Time":        Preview,
+	}
+
+	if len(episodes) != len(want) {
+		t.Fatalf("got %d episodes, want %d", len(episodes), len(want))
+	}
+
+	for _, ep := range episodes {
+		if typ, ok := want[ep.Title()]; !ok || ep.Type() != string(typ) {
+			t.Errorf("%q: got type %q, want %q", ep.Title(), ep.Type(), typ)
+		}
+	}
+
+	movie, err := series.GetEpisodeBySlug("TY-movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Type() != string(Movie) {
+		t.Errorf("got type %q for the movie", movie.Type())
+	}
+}
+
+func TestItemClasses(t *testing.T) {
+	tests := []struct {
+		itemClass string
+		videoType string
+		typ       EpisodeType
+		kind      AssetKind
+	}{
+		{"Episode", "", Regular, EpisodeAsset},
+		{"Preview", "", Preview, TrailerAsset},
+		{"trailer", "", Preview, TrailerAsset},
+		{"Clip", "", Extra, ClipAsset},
+		{"Bonus", "", Extra, ExtraAsset},
+		{"Feature", "", Movie, MovieAsset},
+		{"", "Preview", Preview, TrailerAsset},
+		{"promo", "OVA", Ova, EpisodeAsset},
+		{"promo", "", "", EpisodeAsset},
+	}
+
+	for _, test := range tests {
+		if typ := parseEpisodeType(test.itemClass, test.videoType); typ != test.typ {
+			t.Errorf("%q, %q: got type %q, want %q", test.itemClass, test.videoType, typ, test.typ)
+		}
+
+		if kind := parseAssetKind(test.itemClass, test.videoType); kind != test.kind {
+			t.Errorf("%q, %q: got kind %q, want %q", test.itemClass, test.videoType, kind, test.kind)
+		}
+	}
+}
+
+func TestEpisodeTypeOfRecapClass(t *testing.T) {
+	playersData, err := getPlayersData([]byte(netogePlayersData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep := &Episode{}
+	if err := ep.collectPlayersData(playersData); err != nil {
+		t.Fatal(err)
+	}
+
+	if ep.Type() != string(Regular) || ep.TypeCode() != "e" {
+		t.Errorf("got type %q with code %q, want %q with code %q", ep.Type(), ep.TypeCode(), Regular, "e")
+	}
+}
@@ -0,0 +1,73 @@
+package funimation
+
+import (
+	"flag"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"testing"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+var record = flag.Bool("record", false, "record fixtures from the live website into testdata/fixtures")
+
+// TestFixtures runs the client against responses recorded from the live
+// website. When the website changes, record them again with
+//
+//	go test ./lib -run TestFixtures -record
+//
+// and diff testdata/fixtures to see what changed.
+func TestFixtures(t *testing.T) {
+	dir := filepath.Join("testdata", "fixtures")
+
+	var transport http.RoundTripper
+	if *record {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		transport = funimationtest.NewRecorder(dir, http.DefaultTransport)
+	} else {
+		replayer, err := funimationtest.NewReplayer(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if replayer.Len() == 0 {
+			t.Skip("no fixtures recorded; run with -record to record them")
+		}
+
+		transport = replayer
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewWithHttpClient(&http.Client{
+		Jar: jar,
+		Transport: transport,
+	})
+
+	series, err := client.GetSeries("steins-gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(episodes) == 0 {
+		t.Fatal("no episodes found")
+	}
+
+	for _, ep := range episodes {
+		if len(ep.Languages()) == 0 {
+			t.Errorf("season %d %s %v has no languages", ep.SeasonNumber(), ep.Type(), ep.EpisodeNumber())
+		}
+	}
+}
@@ -7,30 +7,28 @@ import (
 	"errors"
 	"strconv"
 	"fmt"
-	"math/rand"
+	"strings"
+	"log/slog"
+	"sync"
+	"golang.ssttevee.com/funimation/lib/rate"
 )
 var NotFound = errors.New("Not found")
 
-const uaFmt = "Mozilla/%.1f (Linux; %s; Android %.1f.%d; en-us) AppleWebkit/%.2f (KHTML, like Gecko) Version/%.1f Mobile Safari/%.2f"
-var mobileUA string
-
-func init() {
-	RegenerateUA()
-}
-
 type Client struct {
 	httpClient *http.Client
-}
+	logger     *slog.Logger
+	userAgent  UserAgentStrategy
 
-func RegenerateUA() {
-	mobileUA = fmt.Sprintf(uaFmt,
-		rand.Float32() * float32(10), // mozilla version
-		[]string{"N", "U", "I"}[rand.Intn(3)], // security strength
-		rand.Float32() * float32(10), // android major and minor version
-		rand.Intn(10), // android revision number
-		rand.Float32() * float32(1000), // webkit version
-		rand.Float32() * float32(10), // safari version
-		rand.Float32() * float32(1000)) // safari build number
+	// mediaTransport downloads videos, if they don't go the same way as
+	// the website's pages
+	mediaTransport http.RoundTripper
+
+	retry    RetryPolicy
+	limiter  *rate.Bucket
+	guessers []UrlGuesser
+
+	// collectCookies primes the cookie jar before the first listing
+	collectCookies sync.Once
 }
 
 func New(cookieJar *cookiejar.Jar) (*Client) {
@@ -38,6 +36,20 @@ func New(cookieJar *cookiejar.Jar) (*Client) {
 		httpClient: &http.Client{
 			Jar: cookieJar,
 		},
+		userAgent: NewRealisticUserAgent(nil),
+		retry: DefaultRetryPolicy,
+		limiter: rate.NewBucket(DefaultRequestRate, DefaultRequestBurst),
+	}
+}
+
+// NewWithHttpClient returns a client that makes its requests with the given
+// http client, which should have a cookie jar
+func NewWithHttpClient(httpClient *http.Client) (*Client) {
+	return &Client{
+		httpClient: httpClient,
+		userAgent: NewRealisticUserAgent(nil),
+		retry: DefaultRetryPolicy,
+		limiter: rate.NewBucket(DefaultRequestRate, DefaultRequestBurst),
 	}
 }
 
@@ -51,10 +63,18 @@ func (f *Client) Login(email, password string) error {
 		},
 	}
 
-	res, err := f.httpClient.PostForm("http://www.funimation.com/login", url.Values(data))
+	req, err := http.NewRequest("POST", "http://www.funimation.com/login", strings.NewReader(url.Values(data).Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := f.do(req)
 	if err != nil {
 		return err
 	}
+	res.Body.Close()
 
 	if res.Header.Get("Location") == "http://www.funimation.com/login" {
 		return errors.New("Login fail")
@@ -72,7 +92,7 @@ func (f *Client) GetSeriesById(showId int) (*Series, error) {
 }
 
 func (f *Client) getShowApi(param string, value interface{}) (*Series, error) {
-	ajax, err := getJsonObject(f.httpClient, fmt.Sprintf("http://www.funimation.com/frontend_api/getShow/%s/%v", param, value))
+	ajax, err := getJsonObject(f, fmt.Sprintf("http://www.funimation.com/frontend_api/getShow/%s/%v", param, value))
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +137,7 @@ func (f *Client) getShowApi(param string, value interface{}) (*Series, error) {
 
 	return &Series{
 		slug: showSlug.(string),
-		client: f.httpClient,
+		client: f,
 		showId: showId,
 		name: title.(string),
 		description: summary.(string),
@@ -127,7 +147,7 @@ func (f *Client) getShowApi(param string, value interface{}) (*Series, error) {
 
 func (f *Client) GetEpisodeFromUrl(episodeUrl string) (*Episode, error) {
 	ep := &Episode{
-		client: f.httpClient,
+		client: f,
 		url: episodeUrl,
 	}
 
@@ -0,0 +1,612 @@
+package funimation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+func newTestClient(t *testing.T) (*Client, *funimationtest.Server) {
+	srv := funimationtest.NewDefaultServer()
+	t.Cleanup(srv.Close)
+
+	return NewWithHttpClient(srv.Client()), srv
+}
+
+func TestGetSeries(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	bySlug, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bySlug.ShowId() != 1001 || bySlug.Title() != "Multi Season" {
+		t.Errorf("got show %d %q", bySlug.ShowId(), bySlug.Title())
+	}
+
+	byId, err := client.GetSeriesById(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if byId.Title() != bySlug.Title() {
+		t.Errorf("got %q by id and %q by slug", byId.Title(), bySlug.Title())
+	}
+
+	if _, err := client.GetSeries("nope"); err != NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+func TestGetAllEpisodes(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(episodes) != 7 {
+		t.Fatalf("got %d episodes, want 7", len(episodes))
+	}
+
+	for i, ep := range episodes[:6] {
+		if ep.SeasonNumber() != i/3+1 || ep.EpisodeNumber() != float32(i%3+1) || ep.Type() != string(Regular) {
+			t.Errorf("episode %d: got season %d %s %v", i, ep.SeasonNumber(), ep.Type(), ep.EpisodeNumber())
+		}
+	}
+
+	if ova := episodes[6]; ova.Type() != Ova || ova.Title() != "The OVA" {
+		t.Errorf("got %s %q, want the ova", ova.Type(), ova.Title())
+	}
+
+	if len(episodes[0].Languages()) != 2 {
+		t.Errorf("got languages %v, want sub and dub", episodes[0].Languages())
+	}
+
+	ep, err := series.GetEpisode(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ep.SeasonNumber() != 2 || ep.EpisodeNumber() != 2 {
+		t.Errorf("got season %d episode %v, want season 2 episode 2", ep.SeasonNumber(), ep.EpisodeNumber())
+	}
+}
+
+func TestGetVideoUrl(t *testing.T) {
+	tests := []struct {
+		episodeUrl string
+		lang       EpisodeLanguage
+		quality    EpisodeQuality
+		err        string
+	}{
+		{"multi-season/videos/official/MS-episode-1-1", Subbed, StandardDefinition, ""},
+		{"multi-season/videos/official/MS-episode-1-1", Dubbed, HighDefinition, "This video is members only"},
+		{"multi-season/videos/official/MS-episode-1-1", Subbed, FullHighDefinition, "This video is members only"},
+		{"paywalled/videos/official/PW-episode-1-2", Subbed, StandardDefinition, "This video is members only"},
+		{"mature/videos/official/MA-episode-1-1", Dubbed, StandardDefinition, "This video is members only and you must be at least 17"},
+		{"territory-blocked/videos/official/TB-episode-1-1", Subbed, StandardDefinition, ""},
+		{"territory-blocked/videos/official/TB-episode-1-1", Dubbed, StandardDefinition, "This video is not available in your territory"},
+		{"territory-blocked/videos/official/TB-episode-1-1", Subbed, FullHighDefinition, "No videos found with the given language and quality"},
+	}
+
+	client, _ := newTestClient(t)
+
+	for _, test := range tests {
+		ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/" + test.episodeUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		url, err := ep.GetVideoUrl(test.lang, test.quality)
+		if test.err == "" && err != nil {
+			t.Errorf("%s %s %s: %v", test.episodeUrl, test.lang, test.quality, err)
+		} else if test.err == "" && !strings.HasPrefix(url, "http") {
+			t.Errorf("%s %s %s: got url %q", test.episodeUrl, test.lang, test.quality, url)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s %s %s: got error %v, want %q", test.episodeUrl, test.lang, test.quality, err, test.err)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	if err := client.Login("subscriber@example.com", "wrong"); err == nil {
+		t.Error("expected login with wrong password to fail")
+	}
+
+	if err := client.Login("subscriber@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/paywalled/videos/official/PW-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := ep.GetBestQuality(Subbed, true); q != HighDefinition {
+		t.Errorf("got best quality %s for subscriber, want %s", q, HighDefinition)
+	}
+
+	if _, err := ep.GetVideoUrl(Subbed, HighDefinition); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFailedListingDoesNotLeak(t *testing.T) {
+	client, srv := newTestClient(t)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every episode page fails, but only the first error is returned
+	srv.Fail(&funimationtest.Failure{Path: "/shows/multi-season/videos/official/", Count: 100, Status: http.StatusNotFound})
+
+	if _, err := series.GetAllEpisodes(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// the goroutines collecting the other episodes still finish
+	left := func() int {
+		buf := make([]byte, 1<<20)
+		return strings.Count(string(buf[:runtime.Stack(buf, true)]), "lib.searchSection.func")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for left() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := left(); n > 0 {
+		t.Errorf("%d goroutines of a failed listing left running", n)
+	}
+}
+
+func TestEpisodeAssets(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/extras/videos/official/EX-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assets := ep.Assets()
+	if len(assets) != 3 {
+		t.Fatalf("got %d assets, want 3", len(assets))
+	}
+
+	if ep.Video() != assets[0] || ep.Title() != "Episode 1 of Season 1" {
+		t.Errorf("got episode %q, want the first asset", ep.Title())
+	}
+
+	want := []struct {
+		playerId string
+		kind     AssetKind
+		title    string
+		langs    int
+	}{
+		{"showsPlayer", EpisodeAsset, "Episode 1 of Season 1", 2},
+		{"trailerPlayer", TrailerAsset, "Trailer", 1},
+		{"extrasPlayer", ExtraAsset, "Behind the Scenes", 2},
+	}
+
+	for i, w := range want {
+		a := assets[i]
+		if a.PlayerId() != w.playerId || a.Kind() != w.kind || a.Title() != w.title || len(a.Languages()) != w.langs {
+			t.Errorf("asset %d: got %s %s %q with %d languages", i, a.PlayerId(), a.Kind(), a.Title(), len(a.Languages()))
+		}
+	}
+
+	url, err := assets[1].GetVideoUrl(Subbed, StandardDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(url, "EXTRAILER") {
+		t.Errorf("got trailer url %q", url)
+	}
+}
+
+func TestEpisodeWithoutPlayer(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	_, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/extras/videos/official/EX-episode-1-2")
+	if err == nil || err.Error() != "episode: no player found on page" {
+		t.Errorf("got error %v", err)
+	}
+
+	ep := &Episode{}
+	if err := ep.collectPlayersData(nil); err == nil {
+		t.Error("expected an error for no players")
+	}
+}
+
+func TestSeriesAssets(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("extras")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		get    func() (AssetList, error)
+		kind   AssetKind
+		titles []string
+	}{
+		{series.GetTrailers, TrailerAsset, []string{"Season 1 Trailer", "Dub Trailer"}},
+		{series.GetClips, ClipAsset, []string{"Opening Song"}},
+		{series.GetExtras, ExtraAsset, []string{"Cast Interviews"}},
+		{series.GetMovies, MovieAsset, []string{"The Movie"}},
+	}
+
+	for _, test := range tests {
+		assets, err := test.get()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(assets) != len(test.titles) {
+			t.Fatalf("got %d %ss, want %d", len(assets), test.kind, len(test.titles))
+		}
+
+		for i, a := range assets {
+			if a.Kind() != test.kind || a.Title() != test.titles[i] {
+				t.Errorf("got %s %q, want %s %q", a.Kind(), a.Title(), test.kind, test.titles[i])
+			}
+
+			if _, err := a.GetVideoUrl(Subbed, StandardDefinition); err != nil {
+				t.Errorf("%s: %v", a.Title(), err)
+			}
+		}
+	}
+
+	if _, err := ParseAssetKind("Trailers"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := ParseAssetKind("bloopers"); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestIndependentClients(t *testing.T) {
+	srv := funimationtest.NewDefaultServer()
+	t.Cleanup(srv.Close)
+
+	for i := 0; i < 2; i++ {
+		series, err := NewWithHttpClient(srv.Client()).GetSeries("multi-season")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := series.GetAllEpisodes(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each client collects cookies into its own jar
+	primed := 0
+	for _, req := range srv.Requests() {
+		if req == "/videos/episodes" {
+			primed++
+		}
+	}
+
+	if primed != 2 {
+		t.Errorf("cookies collected %d times, want once per client", primed)
+	}
+}
+
+// TestConcurrentUse shares a series and its episodes between goroutines, and
+// should be run with -race
+func TestConcurrentUse(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.SetRequestRate(0, 1)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not collected until GuessVideoUrl needs it
+	lazy := &Episode{
+		client: client,
+		url:    "http://www.funimation.com/shows/multi-season/videos/official/MS-episode-1-1",
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			episodes, err := series.GetAllEpisodes()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for _, ep := range episodes {
+				_ = episodes.String()
+				ep.Title()
+				ep.Type()
+				ep.Languages()
+				ep.GetBestQuality(Subbed, true)
+			}
+
+			if _, err := series.GetEpisode(1); err != nil {
+				errs <- err
+			}
+
+			for _, kind := range AssetKinds {
+				if _, err := series.GetAssets(kind); err != nil {
+					errs <- err
+				}
+			}
+
+			if _, err := lazy.GuessVideoUrl(Subbed, StandardDefinition); err != nil {
+				errs <- err
+			}
+			lazy.Title()
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	first, _ := series.GetAllEpisodes()
+	again, _ := series.GetAllEpisodes()
+	if len(first) == 0 || &first[0] != &again[0] {
+		t.Error("every caller should get the same episodes")
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	client, srv := newTestClient(t)
+	srv.TokenLifetime = time.Hour
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/extras/videos/official/EX-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, asset := range ep.Assets() {
+		if expiry := asset.TokenExpiry(); time.Until(expiry) < 59*time.Minute || time.Until(expiry) > time.Hour {
+			t.Errorf("%s: token expires at %v", asset.Title(), expiry)
+		}
+
+		if asset.TokenExpired() {
+			t.Errorf("%s: token should not have expired", asset.Title())
+		}
+
+		stale, err := asset.GetVideoUrl(Subbed, StandardDefinition)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv.ExpireTokens()
+
+		if status := fetchStatus(t, client, stale); status != http.StatusForbidden {
+			t.Errorf("%s: got status %d with an expired token", asset.Title(), status)
+		}
+
+		fresh, err := asset.Refresh()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fresh.PlayerId() != asset.PlayerId() || fresh.Title() != asset.Title() {
+			t.Errorf("refreshed %q into %q", asset.Title(), fresh.Title())
+		}
+
+		url, err := fresh.GetVideoUrl(Subbed, StandardDefinition)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status := fetchStatus(t, client, url); status != http.StatusOK {
+			t.Errorf("%s: got status %d with a fresh token", asset.Title(), status)
+		}
+	}
+
+	srv.TokenLifetime = 30 * time.Second
+	if err := ep.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ep.Video().TokenExpired() {
+		t.Error("a token about to expire should count as expired")
+	}
+}
+
+func fetchStatus(t *testing.T, client *Client, url string) int {
+	t.Helper()
+
+	res, err := client.get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	return res.StatusCode
+}
+
+func TestPerLanguageTokens(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/extras/videos/official/EX-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lang := range []EpisodeLanguage{Subbed, Dubbed} {
+		url, err := ep.GuessVideoUrl(lang, StandardDefinition)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		funId := "EXS1E1" + string(lang)
+		if !strings.Contains(url, "/"+funId+"/") || !strings.HasSuffix(url, "?token-"+funId) {
+			t.Errorf("%s: got url %s, want the id and token of %s", lang, url, funId)
+		}
+	}
+
+	// the trailer only has a sub
+	trailer := ep.Assets()[1]
+
+	_, err = trailer.GuessVideoUrl(Dubbed, StandardDefinition)
+
+	var langErr *LanguageError
+	if !errors.As(err, &langErr) {
+		t.Fatalf("got error %v, want a LanguageError", err)
+	}
+
+	if langErr.Language != Dubbed || len(langErr.Available) != 1 || langErr.Available[0] != Subbed {
+		t.Errorf("got %v", langErr)
+	}
+
+	if _, err := trailer.GetVideoUrl(Dubbed, StandardDefinition); !errors.As(err, &langErr) {
+		t.Errorf("got error %v, want a LanguageError", err)
+	}
+}
+
+func TestRenditions(t *testing.T) {
+	clip := &playlistItemClip{
+		basePlaylistItem: basePlaylistItem{title: "Episode 1"},
+		videoSet: []*videoItem{
+			{funimationId: "ABC0001", authToken: "?token-a", languageMode: Subbed, sdUrl: "http://cdn.example.com/a.mp4"},
+			{funimationId: "ABC0002", authToken: "?token-b", languageMode: Subbed, sdUrl: "http://cdn.example.com/b.mp4"},
+		},
+	}
+
+	a, err := newAsset(&playerData{playlist: []playlistItem{clip}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first video is the asset's own, and keeps its own token
+	if url, err := a.GetVideoUrl(Subbed, StandardDefinition); err != nil || url != "http://cdn.example.com/a.mp4" {
+		t.Errorf("got url %q, %v", url, err)
+	}
+
+	if id, _ := a.getFunimationId(Subbed); id != "ABC0001" || a.authTokens[Subbed] != "?token-a" {
+		t.Errorf("got id %q with token %q", id, a.authTokens[Subbed])
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Asset
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, asset := range []*Asset{a, &decoded} {
+		renditions := asset.Renditions(Subbed)
+		if len(renditions) != 2 {
+			t.Fatalf("got %d renditions, want 2", len(renditions))
+		}
+
+		second := renditions[1]
+		if url, err := second.GetVideoUrl(StandardDefinition); err != nil || url != "http://cdn.example.com/b.mp4" || second.FunimationId() != "ABC0002" || second.authToken != "?token-b" {
+			t.Errorf("got second rendition %q with url %q, %v", second.FunimationId(), url, err)
+		}
+	}
+}
+
+func TestClientLogger(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	var buf bytes.Buffer
+	client.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	if _, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/multi-season/videos/official/MS-episode-1-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/multi-season/videos/official/nope"); err == nil {
+		t.Fatal("expected an error for a missing episode")
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	want := []struct {
+		level, msg string
+		fields     []string
+	}{
+		{"DEBUG", "request", []string{"method", "url", "status", "duration"}},
+		{"DEBUG", "collected episode", []string{"episode", "season", "number", "title"}},
+		{"WARN", "request", []string{"url", "status"}},
+	}
+
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d:\n%s", len(records), len(want), buf.String())
+	}
+
+	for i, w := range want {
+		if records[i]["level"] != w.level || records[i]["msg"] != w.msg {
+			t.Errorf("record %d: got %v %v, want %s %s", i, records[i]["level"], records[i]["msg"], w.level, w.msg)
+		}
+
+		for _, field := range w.fields {
+			if _, ok := records[i][field]; !ok {
+				t.Errorf("record %d: missing %s", i, field)
+			}
+		}
+	}
+}
+
+func TestRequestRate(t *testing.T) {
+	client, srv := newTestClient(t)
+	client.SetRequestRate(20, 1)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := series.GetAllEpisodes(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every request after the first waits for the one before it
+	n := len(srv.Requests())
+	if elapsed, want := time.Since(start), time.Duration(n-2)*time.Second/20; elapsed < want {
+		t.Errorf("made %d requests in %v, want at least %v", n, elapsed, want)
+	}
+}
@@ -0,0 +1,185 @@
+package funimationtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"golang.ssttevee.com/funimation/lib/redact"
+)
+
+// Sanitize removes auth tokens and user ids from a response body
+func Sanitize(b []byte) []byte {
+	return redact.Body(b)
+}
+
+// SanitizeUrl removes the query string from video urls, where the auth
+// token is kept
+func SanitizeUrl(rawUrl string) string {
+	return redact.Url(rawUrl)
+}
+
+func fixtureKey(req *http.Request) string {
+	return req.Method + " " + SanitizeUrl(req.URL.String())
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fixtureName is stable for the same request so that fixtures recorded at
+// different times can be compared with diff
+func fixtureName(key string) string {
+	sum := sha1.Sum([]byte(key))
+
+	name := key
+	if i := strings.Index(name, "://"); i != -1 {
+		name = strings.ToLower(key[:strings.Index(key, " ")]) + "-" + name[i+3:]
+	}
+
+	name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	return name + "-" + hex.EncodeToString(sum[:4]) + ".http"
+}
+
+// Recorder is a round tripper that writes every response it receives to a
+// fixture file in Dir, with auth tokens, cookies and user ids removed
+type Recorder struct {
+	Dir       string
+	Transport http.RoundTripper
+
+	mu sync.Mutex
+}
+
+func NewRecorder(dir string, rt http.RoundTripper) *Recorder {
+	return &Recorder{
+		Dir:       dir,
+		Transport: rt,
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// give the caller the real response
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := r.write(req, res, body); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *Recorder) write(req *http.Request, res *http.Response, body []byte) error {
+	body = Sanitize(body)
+
+	header := redact.Header(res.Header)
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	fixture := &http.Response{
+		Status:        res.Status,
+		StatusCode:    res.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}
+
+	dump, err := httputil.DumpResponse(fixture, true)
+	if err != nil {
+		return err
+	}
+
+	key := fixtureKey(req)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, key)
+	buf.Write(dump)
+
+	return os.WriteFile(filepath.Join(r.Dir, fixtureName(key)), buf.Bytes(), 0644)
+}
+
+// Replayer is a round tripper that answers requests with the fixtures
+// written by a Recorder, and fails requests that were not recorded
+type Replayer struct {
+	fixtures map[string][]byte
+}
+
+// NewReplayer loads every fixture in dir
+func NewReplayer(dir string) (*Replayer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.http"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replayer{
+		fixtures: make(map[string][]byte),
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		nl := bytes.IndexByte(b, '\n')
+		if nl == -1 {
+			return nil, fmt.Errorf("funimationtest: %s is not a fixture", file)
+		}
+
+		r.fixtures[strings.TrimSpace(string(b[:nl]))] = b[nl+1:]
+	}
+
+	return r, nil
+}
+
+// Len returns the number of fixtures loaded
+func (r *Replayer) Len() int {
+	return len(r.fixtures)
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	key := fixtureKey(req)
+
+	b, ok := r.fixtures[key]
+	if !ok {
+		return nil, fmt.Errorf("funimationtest: no fixture for %s", key)
+	}
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+}
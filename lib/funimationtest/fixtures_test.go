@@ -0,0 +1,89 @@
+package funimationtest_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.ssttevee.com/funimation/lib"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := funimationtest.NewDefaultServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	jar, _ := cookiejar.New(nil)
+	recording := funimation.NewWithHttpClient(&http.Client{
+		Jar:       jar,
+		Transport: funimationtest.NewRecorder(dir, srv.Transport(http.DefaultTransport)),
+	})
+
+	if err := recording.Login("subscriber@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	series, err := recording.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.http"))
+	if len(files) == 0 {
+		t.Fatal("no fixtures recorded")
+	}
+
+	for _, file := range files {
+		b, _ := os.ReadFile(file)
+		for _, secret := range []string{"token-", "session-", "Set-Cookie"} {
+			if strings.Contains(string(b), secret) {
+				t.Errorf("%s contains %q", filepath.Base(file), secret)
+			}
+		}
+	}
+
+	replayer, err := funimationtest.NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jar, _ = cookiejar.New(nil)
+	replaying := funimation.NewWithHttpClient(&http.Client{
+		Jar:       jar,
+		Transport: replayer,
+	})
+
+	series, err = replaying.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recorded) != len(replayed) {
+		t.Fatalf("replayed %d episodes, recorded %d", len(replayed), len(recorded))
+	}
+
+	for i, ep := range replayed {
+		if ep.Title() != recorded[i].Title() || ep.GetBestQuality(funimation.Subbed, true) != recorded[i].GetBestQuality(funimation.Subbed, true) {
+			t.Errorf("replayed episode %d differs from recorded", i)
+		}
+	}
+
+	if _, err := replaying.GetSeries("paywalled"); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Errorf("expected missing fixture error, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package funimationtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+func mp4Box(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+// VideoFile returns a small mp4 file whose movie header has the given
+// duration
+func VideoFile(duration time.Duration) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], uint32(duration/time.Millisecond))
+
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom\x00\x00\x02\x00")),
+		mp4Box("moov", mp4Box("mvhd", mvhd)),
+		mp4Box("mdat", make([]byte, 4096)),
+	}, nil)
+}
+
+func newEpisode(prefix string, season, number int, kind string, qualities map[string]Access, languages ...string) *Episode {
+	ep := &Episode{
+		Slug:        fmt.Sprintf("%s-episode-%d-%d", prefix, season, number),
+		Season:      season,
+		Number:      float32(number),
+		Title:       fmt.Sprintf("Episode %d of Season %d", number, season),
+		Description: fmt.Sprintf("Things happen in episode %d.", number),
+		Kind:        kind,
+	}
+
+	for _, lang := range languages {
+		funId := fmt.Sprintf("%sS%dE%d%s", prefix, season, number, lang)
+		ep.Videos = append(ep.Videos, &Video{
+			Language:     lang,
+			FunimationId: funId,
+			AuthToken:    "?token-" + funId,
+			Duration:     1440,
+			Qualities:    qualities,
+		})
+	}
+
+	return ep
+}
+
+// MultiSeasonShow has two seasons of three public episodes each, subbed and
+// dubbed, followed by an ova. Higher qualities are for subscribers.
+func MultiSeasonShow() *Show {
+	show := &Show{
+		Id:        1001,
+		Slug:      "multi-season",
+		Title:     "Multi Season",
+		Summary:   "A show with more than one season.",
+		Thumbnail: "multi-season.jpg",
+	}
+
+	qualities := map[string]Access{"sd": Public, "hd": Subscribers, "fhd": Subscribers}
+	for season := 1; season <= 2; season++ {
+		for number := 1; number <= 3; number++ {
+			show.Episodes = append(show.Episodes, newEpisode("MS", season, number, "Episode", qualities, "sub", "dub"))
+		}
+	}
+
+	ova := newEpisode("MS", 2, 0, "OVA", qualities, "sub")
+	ova.Slug = "multi-season-ova"
+	ova.Title = "The OVA"
+	ova.Class = "ova"
+	show.Episodes = append(show.Episodes, ova)
+
+	return show
+}
+
+// PaywalledShow has two episodes that only subscribers may watch
+func PaywalledShow() *Show {
+	show := &Show{
+		Id:        1002,
+		Slug:      "paywalled",
+		Title:     "Paywalled",
+		Summary:   "A show for subscribers only.",
+		Thumbnail: "paywalled.jpg",
+	}
+
+	qualities := map[string]Access{"sd": Subscribers, "hd": Subscribers}
+	for number := 1; number <= 2; number++ {
+		show.Episodes = append(show.Episodes, newEpisode("PW", 1, number, "Episode", qualities, "sub"))
+	}
+
+	return show
+}
+
+// MatureShow has an episode that must be logged in to watch
+func MatureShow() *Show {
+	return &Show{
+		Id:        1003,
+		Slug:      "mature",
+		Title:     "Mature",
+		Summary:   "A show for adults.",
+		Thumbnail: "mature.jpg",
+		Episodes: []*Episode{
+			newEpisode("MA", 1, 1, "Episode", map[string]Access{"sd": Mature}, "sub", "dub"),
+		},
+	}
+}
+
+// TerritoryBlockedShow has an episode that may not be watched from here,
+// except for its standard definition sub
+func TerritoryBlockedShow() *Show {
+	ep := newEpisode("TB", 1, 1, "Episode", map[string]Access{"sd": TerritoryBlocked, "hd": TerritoryBlocked}, "sub", "dub")
+	ep.Videos[0].Qualities = map[string]Access{"sd": Public, "hd": TerritoryBlocked}
+
+	return &Show{
+		Id:        1004,
+		Slug:      "territory-blocked",
+		Title:     "Territory Blocked",
+		Summary:   "A show licensed elsewhere.",
+		Thumbnail: "territory-blocked.jpg",
+		Episodes:  []*Episode{ep},
+	}
+}
+
+// ExtrasShow has an episode with a trailer and an extra in players of their
+// own, an episode whose page has no player at all, and two trailers, a clip,
+// an extra and a movie in the other sections of its listing
+func ExtrasShow() *Show {
+	qualities := map[string]Access{"sd": Public}
+
+	ep := newEpisode("EX", 1, 1, "Episode", qualities, "sub", "dub")
+	ep.Players = []*Player{
+		{
+			Id:    "trailerPlayer",
+			Class: "trailer",
+			Title: "Trailer",
+			Videos: []*Video{
+				{Language: "sub", FunimationId: "EXTRAILER", AuthToken: "?token-EXTRAILER", Duration: 90, Qualities: qualities},
+			},
+		},
+		{
+			Id:    "extrasPlayer",
+			Class: "extra",
+			Title: "Behind the Scenes",
+			Videos: []*Video{
+				{Language: "sub", FunimationId: "EXEXTRA", AuthToken: "?token-EXEXTRA", Duration: 600, Qualities: qualities},
+				{Language: "dub", FunimationId: "EXEXTRADUB", AuthToken: "?token-EXEXTRADUB", Duration: 600, Qualities: qualities},
+			},
+		},
+	}
+
+	noPlayer := newEpisode("EX", 1, 2, "Episode", qualities, "sub")
+	noPlayer.NoPlayer = true
+
+	show := &Show{
+		Id:        1005,
+		Slug:      "extras",
+		Title:     "Extras",
+		Summary:   "A show with bonus videos.",
+		Thumbnail: "extras.jpg",
+		Episodes:  []*Episode{ep, noPlayer},
+	}
+
+	// the other sections of the listing
+	for _, other := range []struct {
+		class, kind, title string
+	}{
+		{"trailer", "Trailer", "Season 1 Trailer"},
+		{"trailer", "Trailer", "Dub Trailer"},
+		{"clip", "Clip", "Opening Song"},
+		{"extra", "Extra", "Cast Interviews"},
+		{"movie", "Movie", "The Movie"},
+	} {
+		n := len(show.Episodes)
+
+		video := newEpisode("EX", 1, n, other.kind, qualities, "sub")
+		video.Slug = fmt.Sprintf("EX-%s-%d", other.class, n)
+		video.Number = 0
+		video.Title = other.title
+		video.Class = other.class
+		show.Episodes = append(show.Episodes, video)
+	}
+
+	return show
+}
+
+// TypesShow has one episode of every type, each with its own item class.
+// The regular episode has "special" in its title.
+func TypesShow() *Show {
+	show := &Show{
+		Id:        1006,
+		Slug:      "types",
+		Title:     "Types",
+		Summary:   "A show with every type of episode.",
+		Thumbnail: "types.jpg",
+	}
+
+	for i, t := range []struct {
+		class, kind, title string
+	}{
+		{"episode", "Episode", "A Special Day"},
+		{"ova", "OVA", "The OVA"},
+		{"special", "Special", "The Special"},
+		{"preview", "Preview", "Next Time"},
+		{"movie", "Movie", "The Movie"},
+		{"extra", "Extra", "Behind the Scenes"},
+	} {
+		ep := newEpisode("TY", 1, i+1, t.kind, map[string]Access{"sd": Public}, "sub")
+		ep.Slug = "TY-" + t.class
+		ep.Title = t.title
+		ep.Class = t.class
+		show.Episodes = append(show.Episodes, ep)
+	}
+
+	return show
+}
+
+// NewDefaultServer serves every scenario in this package and has a
+// subscriber account "subscriber@example.com" and a free account
+// "free@example.com", both with the password "password"
+func NewDefaultServer() *Server {
+	s := NewServer(MultiSeasonShow(), PaywalledShow(), MatureShow(), TerritoryBlockedShow(), ExtrasShow(), TypesShow())
+	s.AddAccount(&Account{Email: "subscriber@example.com", Password: "password", Subscriber: true})
+	s.AddAccount(&Account{Email: "free@example.com", Password: "password"})
+
+	return s
+}
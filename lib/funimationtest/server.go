@@ -0,0 +1,658 @@
+// Package funimationtest provides a fake funimation website for testing the
+// client without a network connection.
+//
+// The server answers for every host, so clients should be made with
+// Server.Client which sends requests for www.funimation.com and the video
+// cdn to the fake server instead.
+package funimationtest // import "golang.ssttevee.com/funimation/lib/funimationtest"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const siteUrl = "http://www.funimation.com"
+
+// Access is who may watch a video
+type Access int
+
+const (
+	Public Access = iota
+	Members
+	Subscribers
+	Mature
+	TerritoryBlocked
+)
+
+type Video struct {
+	Language     string
+	FunimationId string
+	AuthToken    string
+	Duration     int
+
+	// Qualities maps "sd", "hd" and "fhd" to who may watch that quality;
+	// missing qualities are not offered at all
+	Qualities map[string]Access
+}
+
+type Episode struct {
+	Slug        string
+	Season      int
+	Number      float32
+	Title       string
+	Description string
+
+	// Kind is the text of the badge on the episode listing, like "Episode",
+	// "OVA" or "Special"
+	Kind string
+
+	// Class is the item class of the video, like "episode", "ova",
+	// "trailer", "clip", "extra" or "movie", which also decides the section
+	// of the listing it is in
+	Class string
+
+	Videos []*Video
+
+	// Players are the other players on the episode page, after the one
+	// with the episode itself
+	Players []*Player
+
+	// NoPlayer leaves every player off the episode page
+	NoPlayer bool
+}
+
+// Player is a player with a single video, like a trailer or an extra
+type Player struct {
+	Id     string
+	Class  string
+	Title  string
+	Videos []*Video
+}
+
+type Show struct {
+	Id        int
+	Slug      string
+	Title     string
+	Summary   string
+	Thumbnail string
+	Episodes  []*Episode
+}
+
+type Account struct {
+	Email      string
+	Password   string
+	Subscriber bool
+}
+
+// Failure makes the server fail the next Count requests whose path starts
+// with Path
+type Failure struct {
+	Path  string
+	Count int
+
+	// Status is the status to answer with, or 0 to drop the connection
+	Status     int
+	RetryAfter string
+
+	// ExpireTokens expires every auth token handed out so far, like a
+	// long download would find when it fails with a 403
+	ExpireTokens bool
+}
+
+type Server struct {
+	*httptest.Server
+
+	// TokenLifetime adds an expiry time to every auth token handed out, after
+	// which videos are refused with a 403
+	TokenLifetime time.Duration
+
+	mu       sync.Mutex
+	tokenGen int
+	shows    []*Show
+	accounts []*Account
+	sessions map[string]*Account
+	requests []string
+	failures []*Failure
+}
+
+// NewServer starts a fake website serving the given shows
+func NewServer(shows ...*Show) *Server {
+	s := &Server{
+		shows:    shows,
+		sessions: make(map[string]*Account),
+	}
+
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// AddAccount registers an account that may log in
+func (s *Server) AddAccount(a *Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts = append(s.accounts, a)
+}
+
+// Fail adds a failure to the requests the server will receive
+func (s *Server) Fail(f *Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, f)
+}
+
+// failure returns the failure for a request, if it should fail
+func (s *Server) failure(r *http.Request) *Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.failures {
+		if f.Count > 0 && strings.HasPrefix(r.URL.Path, f.Path) {
+			f.Count--
+			return f
+		}
+	}
+
+	return nil
+}
+
+// ExpireTokens makes every auth token handed out so far invalid, so that
+// videos are refused with a 403 until their page is fetched again
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenGen++
+}
+
+// authToken returns the current token of a video, without its expiry
+func (s *Server) authToken(v *Video) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokenGen == 0 {
+		return v.AuthToken
+	}
+
+	return fmt.Sprintf("%s-%d", v.AuthToken, s.tokenGen)
+}
+
+// issueToken returns a token to hand out for a video
+func (s *Server) issueToken(v *Video) string {
+	token := s.authToken(v)
+	if s.TokenLifetime > 0 {
+		token += fmt.Sprintf("&exp=%d", time.Now().Add(s.TokenLifetime).Unix())
+	}
+
+	return token
+}
+
+// validToken reports whether the query of a video request has the video's
+// current token, and that it hasn't expired
+func (s *Server) validToken(v *Video, query string) bool {
+	token, exp, hasExp := strings.Cut(query, "&exp=")
+	if token != strings.TrimPrefix(s.authToken(v), "?") {
+		return false
+	}
+
+	if hasExp {
+		unix, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || time.Now().Unix() > unix {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Requests returns the path and query of every request received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// Client returns an http client with a fresh cookie jar that sends every
+// request to the fake server, whatever its host
+func (s *Server) Client() *http.Client {
+	jar, _ := cookiejar.New(nil)
+
+	return &http.Client{
+		Jar:       jar,
+		Transport: s.Transport(http.DefaultTransport),
+	}
+}
+
+// Transport returns a round tripper that sends every request to the fake
+// server through rt
+func (s *Server) Transport(rt http.RoundTripper) http.RoundTripper {
+	target, _ := url.Parse(s.URL)
+	return &rewriteTransport{target, rt}
+}
+
+type rewriteTransport struct {
+	target *url.URL
+	rt     http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+
+	return t.rt.RoundTrip(r)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	s.mu.Unlock()
+
+	if f := s.failure(r); f != nil {
+		if f.ExpireTokens {
+			s.ExpireTokens()
+		}
+
+		if f.Status == 0 {
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+
+		http.Error(w, http.StatusText(f.Status), f.Status)
+		return
+	}
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/frontend_api/getShow/"):
+		s.serveGetShow(w, r)
+	case path == "/videos/episodes":
+		http.SetCookie(w, &http.Cookie{Name: "visited", Value: "1", Path: "/"})
+		fmt.Fprint(w, "<html></html>")
+	case path == "/shows/viewAllFiltered":
+		s.serveViewAllFiltered(w, r)
+	case strings.HasPrefix(path, "/shows/") && strings.Contains(path, "/videos/official/"):
+		s.serveEpisodePage(w, r)
+	case path == "/login" && r.Method == "POST":
+		s.serveLogin(w, r)
+	case strings.HasPrefix(path, "/videos/") || strings.HasPrefix(path, "/008C48/"):
+		s.serveVideo(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) findShow(param, value string) *Show {
+	for _, show := range s.shows {
+		if param == "show_id" && strconv.Itoa(show.Id) == value || param == "funimation_website" && show.Slug == value {
+			return show
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findEpisode(showSlug, episodeSlug string) (*Show, *Episode) {
+	for _, show := range s.shows {
+		if show.Slug != showSlug {
+			continue
+		}
+
+		for _, ep := range show.Episodes {
+			if ep.Slug == episodeSlug {
+				return show, ep
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) serveGetShow(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/frontend_api/getShow/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	show := s.findShow(parts[0], parts[1])
+	if show == nil {
+		writeJson(w, map[string]interface{}{"status": false})
+		return
+	}
+
+	writeJson(w, map[string]interface{}{
+		"status": true,
+		"info": map[string]interface{}{
+			"show_id":            strconv.Itoa(show.Id),
+			"title":              show.Title,
+			"vod_summary_400":    show.Summary,
+			"show_thumbnail":     show.Thumbnail,
+			"funimation_website": show.Slug,
+		},
+	})
+}
+
+func (s *Server) serveViewAllFiltered(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	show := s.findShow("show_id", q.Get("showid"))
+	if show == nil {
+		writeJson(w, map[string]interface{}{"main": ""})
+		return
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	var section []*Episode
+	for _, ep := range show.Episodes {
+		if ep.section() == q.Get("section") {
+			section = append(section, ep)
+		}
+	}
+
+	var buf bytes.Buffer
+	for i, ep := range section {
+		if i < offset || i-offset >= limit {
+			continue
+		}
+
+		var number string
+		if ep.Number != 0 {
+			number = fmt.Sprintf(`<span class="episode-number">%s %v</span>`, html.EscapeString(ep.kind()), ep.Number)
+		}
+
+		var badges bytes.Buffer
+		hd := false
+		for _, v := range ep.Videos {
+			fmt.Fprintf(&badges, "<li>%s</li>", strings.ToUpper(html.EscapeString(v.Language)))
+			if _, ok := v.Qualities["hd"]; ok {
+				hd = true
+			}
+		}
+		if hd {
+			badges.WriteString("<li>HD</li>")
+		}
+
+		fmt.Fprintf(&buf, `<div class="item-cell"><a class="watchLinks" href="%s"><img class="thumbnail" src="%s/thumbnails/%s.jpg"><span class="badge">%s</span> <span class="title">%s</span></a>%s<ul class="availability">%s</ul></div>`,
+			html.EscapeString(episodeUrl(show, ep)), siteUrl, html.EscapeString(ep.Slug), html.EscapeString(ep.kind()), html.EscapeString(ep.Title), number, badges.String())
+	}
+
+	writeJson(w, map[string]interface{}{"main": buf.String()})
+}
+
+func (ep *Episode) kind() string {
+	if ep.Kind == "" {
+		return "Episode"
+	}
+
+	return ep.Kind
+}
+
+func (ep *Episode) class() string {
+	if ep.Class == "" {
+		return "episode"
+	}
+
+	return ep.Class
+}
+
+func (ep *Episode) section() string {
+	switch ep.class() {
+	case "trailer", "clip", "extra", "movie":
+		return ep.class() + "s"
+	}
+
+	return "episodes"
+}
+
+func episodeUrl(show *Show, ep *Episode) string {
+	return fmt.Sprintf("%s/shows/%s/videos/official/%s", siteUrl, show.Slug, ep.Slug)
+}
+
+func (s *Server) account(r *http.Request) *Account {
+	c, err := r.Cookie("session")
+	if err != nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions[c.Value]
+}
+
+func (s *Server) serveLogin(w http.ResponseWriter, r *http.Request) {
+	email, password := r.PostFormValue("email_field"), r.PostFormValue("password_field")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.accounts {
+		if a.Email == email && a.Password == password {
+			session := fmt.Sprintf("session-%d", len(s.sessions)+1)
+			s.sessions[session] = a
+
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+			fmt.Fprint(w, "<html>welcome</html>")
+			return
+		}
+	}
+
+	// a failed login sends the user back to the login page
+	w.Header().Set("Location", siteUrl+"/login")
+	fmt.Fprint(w, "<html>login</html>")
+}
+
+// videoUrl returns what the website puts in place of the url for the given
+// access and viewer
+func (s *Server) videoUrl(v *Video, token, quality string, a *Account) string {
+	access, ok := v.Qualities[quality]
+	if !ok {
+		return ""
+	}
+
+	switch access {
+	case Members:
+		if a == nil {
+			return "subscriptionLoggedOut"
+		}
+	case Subscribers:
+		if a == nil {
+			return "subscriptionLoggedOut"
+		} else if !a.Subscriber {
+			return "nonSubscription"
+		}
+	case Mature:
+		if a == nil {
+			return "matureContentLoggedOut"
+		}
+	case TerritoryBlocked:
+		return "territoryUnavailable"
+	}
+
+	return fmt.Sprintf("%s/videos/%s-%s.mp4%s", s.URL, v.FunimationId, quality, token)
+}
+
+func (s *Server) serveEpisodePage(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/shows/"), "/")
+	show, current := s.findEpisode(parts[0], parts[len(parts)-1])
+	if current == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	a := s.account(r)
+
+	seasons := make(map[int][]interface{})
+	var seasonNums []int
+	for _, ep := range show.Episodes {
+		if _, ok := seasons[ep.Season]; !ok {
+			seasonNums = append(seasonNums, ep.Season)
+		}
+
+		item := map[string]interface{}{
+			"itemAK":      ep.Slug,
+			"itemType":    "clip",
+			"itemClass":   ep.class(),
+			"showId":      strconv.Itoa(show.Id),
+			"showUrl":     show.Slug,
+			"videoType":   "official",
+			"videoUrl":    episodeUrl(show, ep),
+			"artist":      show.Title,
+			"title":       fmt.Sprintf("%v - %s", ep.Number, ep.Title),
+			"description": ep.Description,
+			"number":      strconv.FormatFloat(float64(ep.Number), 'f', 1, 32),
+		}
+
+		// like the real website, only the current episode has its videos
+		if ep == current {
+			item["videoSet"] = s.videoSet(ep.Videos, a)
+		}
+
+		seasons[ep.Season] = append(seasons[ep.Season], item)
+	}
+
+	var playlist []interface{}
+	for _, num := range seasonNums {
+		playlist = append(playlist, map[string]interface{}{
+			"itemAK":    fmt.Sprintf("Season %d", num),
+			"itemType":  "container",
+			"itemClass": "season",
+			"showId":    strconv.Itoa(show.Id),
+			"showUrl":   show.Slug,
+			"artist":    show.Title,
+			"title":     fmt.Sprintf("Season %d", num),
+			"items":     seasons[num],
+		})
+	}
+
+	players := []interface{}{
+		map[string]interface{}{
+			"playerId":       "showsPlayer",
+			"playlist":       playlist,
+			"selectedItemAK": current.Slug,
+		},
+	}
+
+	for _, p := range current.Players {
+		players = append(players, map[string]interface{}{
+			"playerId": p.Id,
+			"playlist": []interface{}{
+				map[string]interface{}{
+					"itemAK":    current.Slug + "-" + p.Id,
+					"itemType":  "clip",
+					"itemClass": p.Class,
+					"showId":    strconv.Itoa(show.Id),
+					"showUrl":   show.Slug,
+					"artist":    show.Title,
+					"title":     p.Title,
+					"videoSet":  s.videoSet(p.Videos, a),
+				},
+			},
+			"selectedItemAK": current.Slug + "-" + p.Id,
+		})
+	}
+
+	if current.NoPlayer {
+		players = []interface{}{}
+	}
+
+	playersData, _ := json.Marshal(players)
+
+	fmt.Fprintf(w, "<html><head><script>\nvar playersData = %s;\n</script></head><body>%s</body></html>", playersData, html.EscapeString(current.Title))
+}
+
+func (s *Server) videoSet(videos []*Video, a *Account) []interface{} {
+	var videoSet []interface{}
+	for _, v := range videos {
+		token := s.issueToken(v)
+		videoSet = append(videoSet, map[string]interface{}{
+			"videoType":    "official",
+			"languageMode": v.Language,
+			"authToken":    token,
+			"duration":     v.Duration,
+			"sdUrl":        s.videoUrl(v, token, "sd", a),
+			"hdUrl":        s.videoUrl(v, token, "hd", a),
+			"hd1080Url":    s.videoUrl(v, token, "fhd", a),
+			"FUNImationID": v.FunimationId,
+		})
+	}
+
+	return videoSet
+}
+
+// cdnBitrates are the bitrates of the progressive downloads on the cdn
+var cdnBitrates = map[string]int{"sd": 1500, "hd": 2500, "fhd": 4000}
+
+// guessable reports whether a video is found at a path on the cdn, where
+// only the progressive downloads of its public qualities are
+func guessable(v *Video, path string) bool {
+	if !strings.HasPrefix(path, "/008C48/") {
+		return true
+	}
+
+	for quality, access := range v.Qualities {
+		if access == Public && strings.HasSuffix(path, fmt.Sprintf("-480-%dK.mp4", cdnBitrates[quality])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) serveVideo(w http.ResponseWriter, r *http.Request) {
+	var video *Video
+
+	for _, show := range s.shows {
+		for _, ep := range show.Episodes {
+			videos := ep.Videos
+			for _, p := range ep.Players {
+				videos = append(videos[:len(videos):len(videos)], p.Videos...)
+			}
+
+			for _, v := range videos {
+				if strings.Contains(r.URL.Path, "/"+v.FunimationId+"-") {
+					video = v
+				}
+			}
+		}
+	}
+
+	if video == nil || !guessable(video, r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.validToken(video, r.URL.RawQuery) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	http.ServeContent(w, r, "video.mp4", time.Time{}, bytes.NewReader(VideoFile(time.Duration(video.Duration)*time.Second)))
+}
@@ -0,0 +1,220 @@
+package funimation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GuessRequest is what is known about a video whose url is to be guessed
+type GuessRequest struct {
+	FunimationId string
+	AuthToken    string
+	Language     EpisodeLanguage
+	Quality      EpisodeQuality
+}
+
+// UrlGuesser makes up the urls a video might be found at on the cdn, from
+// the most to the least likely
+type UrlGuesser interface {
+	Name() string
+	GuessUrls(r *GuessRequest) []string
+}
+
+// UrlTemplate guesses urls by filling in a template. {id} is replaced with
+// the funimation id, {token} with the auth token, and {bitrate} with each
+// bitrate of the quality in turn, or {bitrates} with all of them separated
+// by commas.
+type UrlTemplate struct {
+	name     string
+	format   string
+	bitrates map[EpisodeQuality][]int
+}
+
+func NewUrlTemplate(name, format string, bitrates map[EpisodeQuality][]int) *UrlTemplate {
+	return &UrlTemplate{
+		name:     name,
+		format:   format,
+		bitrates: bitrates,
+	}
+}
+
+func (t *UrlTemplate) Name() string {
+	return t.name
+}
+
+func (t *UrlTemplate) GuessUrls(r *GuessRequest) []string {
+	bitrates := t.bitrates[r.Quality]
+	if len(bitrates) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(bitrates))
+	for i, bitrate := range bitrates {
+		names[i] = strconv.Itoa(bitrate)
+	}
+
+	fill := func(bitrate string) string {
+		return strings.NewReplacer(
+			"{id}", r.FunimationId,
+			"{token}", r.AuthToken,
+			"{bitrate}", bitrate,
+			"{bitrates}", strings.Join(names, ","),
+		).Replace(t.format)
+	}
+
+	if !strings.Contains(t.format, "{bitrate}") {
+		return []string{fill("")}
+	}
+
+	urls := make([]string, len(names))
+	for i, name := range names {
+		urls[i] = fill(name)
+	}
+
+	return urls
+}
+
+// EdgecastMp4 guesses the progressive downloads on the edgecast cdn, whose
+// first guess for each quality is the one the website used to link to
+var EdgecastMp4 = NewUrlTemplate("edgecast",
+	"http://wpc.8c48.edgecastcdn.net/008C48/SV/480/{id}/{id}-480-{bitrate}K.mp4{token}",
+	map[EpisodeQuality][]int{
+		StandardDefinition: {1500, 750},
+		HighDefinition:     {2500, 2000},
+		FullHighDefinition: {4000, 3500},
+	})
+
+// EdgecastHls guesses the hls playlists on the edgecast cdn, which list
+// every bitrate up to the quality's
+var EdgecastHls = NewUrlTemplate("edgecast-hls",
+	"http://wpc.8c48.edgecastcdn.net/038C48/SV/480/{id}/{id}-480-,{bitrates},K.mp4.m3u8{token}",
+	map[EpisodeQuality][]int{
+		StandardDefinition: {750, 1500},
+		HighDefinition:     {750, 1500, 2000, 2500},
+		FullHighDefinition: {750, 1500, 2000, 2500, 4000},
+	})
+
+// DefaultUrlGuessers are the guessers of a client that hasn't been given
+// any, in the order they are tried
+var DefaultUrlGuessers = []UrlGuesser{EdgecastMp4, EdgecastHls}
+
+// SetUrlGuessers sets the guessers that GuessVideoUrl tries, in order. No
+// guessers means DefaultUrlGuessers.
+func (f *Client) SetUrlGuessers(guessers ...UrlGuesser) {
+	f.guessers = guessers
+}
+
+func (f *Client) urlGuessers() []UrlGuesser {
+	if f == nil || len(f.guessers) == 0 {
+		return DefaultUrlGuessers
+	}
+
+	return f.guessers
+}
+
+// client returns the client the asset was fetched with, or nil if it was
+// decoded outside of an episode
+func (a *Asset) client() *Client {
+	if a.episode == nil {
+		return nil
+	}
+
+	return a.episode.getClient()
+}
+
+func (a *Asset) guessRequest(lang EpisodeLanguage, quality EpisodeQuality) (*GuessRequest, error) {
+	funId, err := a.getFunimationId(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken := a.authTokens[lang]
+	if authToken == "" {
+		return nil, errors.New("Couldn't find auth token")
+	}
+
+	if quality == NoQuality {
+		return nil, errors.New("Quality cannot be none")
+	}
+
+	return &GuessRequest{funId, authToken, lang, quality}, nil
+}
+
+// Guess is a url a video might be found at, and what was found there if it
+// was probed
+type Guess struct {
+	Guesser string
+	Url     string
+
+	Status      int
+	Size        int64
+	ContentType string
+	Err         error
+}
+
+// Exists reports whether the probe found the video
+func (g *Guess) Exists() bool {
+	return g.Err == nil && g.Status == http.StatusOK
+}
+
+// GuessVideoUrls returns every url the client's guessers make up for the
+// video, without checking them
+func (a *Asset) GuessVideoUrls(lang EpisodeLanguage, quality EpisodeQuality) ([]*Guess, error) {
+	r, err := a.guessRequest(lang, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	var guesses []*Guess
+	for _, guesser := range a.client().urlGuessers() {
+		for _, url := range guesser.GuessUrls(r) {
+			guesses = append(guesses, &Guess{Guesser: guesser.Name(), Url: url})
+		}
+	}
+
+	if len(guesses) == 0 {
+		return nil, errors.New("guess: no guesses for " + quality.String())
+	}
+
+	return guesses, nil
+}
+
+// ProbeVideoUrls makes a HEAD request to every guessed url of the video,
+// through the client's media route and rate limit, and fills in what was
+// found
+func (a *Asset) ProbeVideoUrls(lang EpisodeLanguage, quality EpisodeQuality) ([]*Guess, error) {
+	guesses, err := a.GuessVideoUrls(lang, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	client := a.client()
+	if client == nil {
+		return nil, errors.New("guess: the video has no client to probe with")
+	}
+
+	for _, g := range guesses {
+		req, err := http.NewRequest("HEAD", g.Url, nil)
+		if err != nil {
+			g.Err = err
+			continue
+		}
+
+		res, err := client.probe(req)
+		if err != nil {
+			g.Err = err
+			continue
+		}
+		res.Body.Close()
+
+		g.Status = res.StatusCode
+		g.Size = res.ContentLength
+		g.ContentType = res.Header.Get("Content-Type")
+
+		client.log().Debug("probed guess", "guesser", g.Guesser, "status", g.Status, "size", g.Size)
+	}
+
+	return guesses, nil
+}
@@ -0,0 +1,91 @@
+package funimation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUrlTemplate(t *testing.T) {
+	r := &GuessRequest{FunimationId: "ABC0001", AuthToken: "?token", Language: Subbed, Quality: HighDefinition}
+
+	want := []string{
+		"http://wpc.8c48.edgecastcdn.net/008C48/SV/480/ABC0001/ABC0001-480-2500K.mp4?token",
+		"http://wpc.8c48.edgecastcdn.net/008C48/SV/480/ABC0001/ABC0001-480-2000K.mp4?token",
+	}
+	if got := EdgecastMp4.GuessUrls(r); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	want = []string{"http://wpc.8c48.edgecastcdn.net/038C48/SV/480/ABC0001/ABC0001-480-,750,1500,2000,2500,K.mp4.m3u8?token"}
+	if got := EdgecastHls.GuessUrls(r); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	custom := NewUrlTemplate("custom", "http://cdn.example.com/{id}/{bitrate}.mp4", map[EpisodeQuality][]int{StandardDefinition: {800}})
+	if got := custom.GuessUrls(r); len(got) != 0 {
+		t.Errorf("got %v for a quality without bitrates", got)
+	}
+}
+
+func TestProbeVideoUrls(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/multi-season/videos/official/MS-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guesses, err := ep.Video().ProbeVideoUrls(Subbed, StandardDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(guesses) != 3 {
+		t.Fatalf("got %d guesses, want 3", len(guesses))
+	}
+
+	var found []*Guess
+	for _, g := range guesses {
+		if g.Exists() {
+			found = append(found, g)
+		}
+	}
+
+	if len(found) != 1 || found[0].Guesser != "edgecast" || !strings.Contains(found[0].Url, "-480-1500K.mp4") {
+		t.Fatalf("found %v, want the 1500K edgecast mp4", found)
+	}
+
+	if found[0].Size <= 0 || found[0].ContentType != "video/mp4" {
+		t.Errorf("got size %d and content type %q", found[0].Size, found[0].ContentType)
+	}
+
+	// the hd video is for members only, so it can't be guessed either
+	if guesses, err := ep.Video().ProbeVideoUrls(Subbed, HighDefinition); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, g := range guesses {
+			if g.Exists() {
+				t.Errorf("found %s", g.Url)
+			}
+		}
+	}
+}
+
+func TestSetUrlGuessers(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.SetUrlGuessers(NewUrlTemplate("custom", "http://cdn.example.com/{id}/{bitrate}.mp4{token}", map[EpisodeQuality][]int{StandardDefinition: {800}}))
+
+	ep, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/multi-season/videos/official/MS-episode-1-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := ep.GuessVideoUrl(Dubbed, StandardDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "http://cdn.example.com/MSS1E1dub/800.mp4?token-MSS1E1dub"; url != want {
+		t.Errorf("got %s, want %s", url, want)
+	}
+}
@@ -0,0 +1,148 @@
+package funimation
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"golang.ssttevee.com/funimation/lib/rate"
+	"golang.ssttevee.com/funimation/lib/redact"
+)
+
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// The default rate limit lets a client make 5 requests a second, with bursts
+// of up to 10
+const (
+	DefaultRequestRate  = 5
+	DefaultRequestBurst = 10
+)
+
+// SetRequestRate limits the requests the client makes to perSecond, after
+// an initial burst. Retries count as requests. A rate of 0 turns the limit
+// off.
+func (f *Client) SetRequestRate(perSecond float64, burst int) {
+	f.limiter = rate.NewBucket(perSecond, burst)
+}
+
+// SetLogger makes the client log the requests it makes, at debug level, and
+// what it finds. A nil logger turns logging off.
+func (f *Client) SetLogger(logger *slog.Logger) {
+	f.logger = logger
+}
+
+func (f *Client) log() (*slog.Logger) {
+	if f.logger == nil {
+		return discardLogger
+	}
+
+	return f.logger
+}
+
+// withHttpClient returns a copy of the client that makes its requests with
+// another http client
+func (f *Client) withHttpClient(httpClient *http.Client) (*Client) {
+	return &Client{
+		httpClient:     httpClient,
+		logger:         f.logger,
+		userAgent:      f.userAgent,
+		mediaTransport: f.mediaTransport,
+		retry:          f.retry,
+		limiter:        f.limiter,
+		guessers:       f.guessers,
+	}
+}
+
+// do makes every request of the client to the website, retrying it as the
+// client's retry policy says
+func (f *Client) do(req *http.Request) (*http.Response, error) {
+	return f.doWith(f.httpClient, req)
+}
+
+// probe makes a request to the cdn through the client's media route, with
+// the same rate limit and retries as requests to the website
+func (f *Client) probe(req *http.Request) (*http.Response, error) {
+	return f.doWith(&http.Client{Transport: f.mediaRoundTripper()}, req)
+}
+
+func (f *Client) doWith(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	f.setUserAgent(req)
+
+	for attempt := 1; ; attempt++ {
+		res, err := f.send(httpClient, req)
+
+		wait, retry := f.retry.wait(attempt, res, err)
+		if !retry || req.Body != nil && req.GetBody == nil {
+			return res, err
+		}
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		logger := f.log().With("url", redact.Url(req.URL.String()), "attempt", attempt, "wait", wait)
+		if err != nil {
+			logger.Info("retrying request", "error", err)
+		} else {
+			logger.Info("retrying request", "status", res.StatusCode)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req.Body = body
+		}
+	}
+}
+
+// send makes a single attempt at a request, once the rate limit allows
+func (f *Client) send(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	if wait := f.limiter.Reserve(1); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	start := time.Now()
+
+	res, err := httpClient.Do(req)
+
+	logger := f.log().With("method", req.Method, "url", redact.Url(req.URL.String()), "duration", time.Since(start))
+	if err != nil {
+		logger.Warn("request failed", "error", err)
+		return nil, err
+	}
+
+	if res.StatusCode >= 400 {
+		logger.Warn("request", "status", res.StatusCode)
+	} else {
+		logger.Debug("request", "status", res.StatusCode)
+	}
+
+	return res, nil
+}
+
+func (f *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.do(req)
+}
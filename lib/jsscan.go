@@ -0,0 +1,414 @@
+package funimation
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"golang.org/x/net/html"
+)
+
+// JsSyntaxError is returned when a script on a page can't be tokenized.
+// Offset is in bytes from the start of the page.
+type JsSyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *JsSyntaxError) Error() string {
+	return fmt.Sprintf("js: %s at offset %d", e.Msg, e.Offset)
+}
+
+type jsTokenKind int
+
+const (
+	jsEOF jsTokenKind = iota
+	jsIdent
+	jsNumber
+	jsString
+	jsTemplate
+	jsRegex
+	jsPunct
+)
+
+type jsToken struct {
+	kind  jsTokenKind
+	start int
+	end   int
+}
+
+// jsLexer splits javascript into tokens, skipping whitespace and comments.
+// It knows just enough of the language to never mistake the inside of a
+// string, comment or regular expression for code.
+type jsLexer struct {
+	src  []byte
+	base int
+	pos  int
+	prev jsToken
+}
+
+func (l *jsLexer) errorf(pos int, format string, args ...interface{}) error {
+	return &JsSyntaxError{l.base + pos, fmt.Sprintf(format, args...)}
+}
+
+func (l *jsLexer) text(t jsToken) string {
+	return string(l.src[t.start:t.end])
+}
+
+func isIdentByte(b byte, first bool) bool {
+	return b == '_' || b == '$' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80 || !first && b >= '0' && b <= '9'
+}
+
+// regexAllowed reports whether a '/' starts a regular expression rather than
+// being a division, judging by the token before it
+func (l *jsLexer) regexAllowed() bool {
+	switch l.prev.kind {
+	case jsIdent:
+		switch l.text(l.prev) {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void", "throw", "case", "do", "else":
+			return true
+		}
+		return false
+	case jsNumber, jsString, jsTemplate, jsRegex:
+		return false
+	case jsPunct:
+		switch l.text(l.prev) {
+		case ")", "]", "}":
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *jsLexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		switch b := l.src[l.pos]; {
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f' || b == '\v':
+			l.pos++
+		case bytes.HasPrefix(l.src[l.pos:], []byte("//")):
+			end := bytes.IndexByte(l.src[l.pos:], '\n')
+			if end == -1 {
+				l.pos = len(l.src)
+			} else {
+				l.pos += end + 1
+			}
+		case bytes.HasPrefix(l.src[l.pos:], []byte("/*")):
+			end := bytes.Index(l.src[l.pos+2:], []byte("*/"))
+			if end == -1 {
+				return l.errorf(l.pos, "unterminated comment")
+			}
+			l.pos += 2 + end + 2
+		case bytes.HasPrefix(l.src[l.pos:], []byte("<!--")):
+			// old browsers hide scripts in html comments
+			l.pos += 4
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (l *jsLexer) next() (jsToken, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return jsToken{}, err
+	}
+
+	start := l.pos
+	if start >= len(l.src) {
+		return jsToken{jsEOF, start, start}, nil
+	}
+
+	var kind jsTokenKind
+	switch b := l.src[start]; {
+	case isIdentByte(b, true):
+		kind = jsIdent
+		for l.pos < len(l.src) && isIdentByte(l.src[l.pos], false) {
+			l.pos++
+		}
+	case b >= '0' && b <= '9' || b == '.' && start+1 < len(l.src) && l.src[start+1] >= '0' && l.src[start+1] <= '9':
+		kind = jsNumber
+		for l.pos < len(l.src) && (isIdentByte(l.src[l.pos], false) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+	case b == '"' || b == '\'':
+		kind = jsString
+		if err := l.scanString(b); err != nil {
+			return jsToken{}, err
+		}
+	case b == '`':
+		kind = jsTemplate
+		if err := l.scanTemplate(); err != nil {
+			return jsToken{}, err
+		}
+	case b == '/' && l.regexAllowed():
+		kind = jsRegex
+		if err := l.scanRegex(); err != nil {
+			return jsToken{}, err
+		}
+	default:
+		kind = jsPunct
+		l.pos++
+
+		// keep comparisons and arrows apart from assignments
+		if b == '=' || b == '!' {
+			for l.pos < len(l.src) && l.src[l.pos] == '=' {
+				l.pos++
+			}
+			if b == '=' && l.pos == start+1 && l.pos < len(l.src) && l.src[l.pos] == '>' {
+				l.pos++
+			}
+		}
+	}
+
+	l.prev = jsToken{kind, start, l.pos}
+	return l.prev, nil
+}
+
+func (l *jsLexer) scanString(quote byte) error {
+	start := l.pos
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '\n':
+			return l.errorf(start, "unterminated string")
+		case quote:
+			l.pos++
+			return nil
+		}
+	}
+
+	return l.errorf(start, "unterminated string")
+}
+
+func (l *jsLexer) scanTemplate() error {
+	start := l.pos
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '`':
+			l.pos++
+			return nil
+		}
+	}
+
+	return l.errorf(start, "unterminated template literal")
+}
+
+func (l *jsLexer) scanRegex() error {
+	start := l.pos
+	inClass := false
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '\n':
+			return l.errorf(start, "unterminated regular expression")
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				// flags
+				for l.pos++; l.pos < len(l.src) && isIdentByte(l.src[l.pos], false); l.pos++ {
+				}
+				return nil
+			}
+		}
+	}
+
+	return l.errorf(start, "unterminated regular expression")
+}
+
+type jsAssignment struct {
+	Name   string
+	Offset int
+	Value  []byte
+}
+
+var jsClosers = map[string]string{"{": "}", "[": "]", "(": ")"}
+
+// scanValue reads the value of an assignment that starts with t. Object and
+// array literals are read up to their closing bracket, while strings,
+// numbers and literal names are read as is. Anything else is not data and
+// ok is false.
+func (l *jsLexer) scanValue(t jsToken) (value []byte, ok bool, err error) {
+	switch t.kind {
+	case jsString, jsNumber:
+		return l.src[t.start:t.end], true, nil
+	case jsIdent:
+		switch l.text(t) {
+		case "true", "false", "null":
+			return l.src[t.start:t.end], true, nil
+		}
+		return nil, false, nil
+	case jsPunct:
+		if s := l.text(t); s != "{" && s != "[" {
+			return nil, false, nil
+		}
+	default:
+		return nil, false, nil
+	}
+
+	stack := []jsToken{t}
+	for len(stack) > 0 {
+		tok, err := l.next()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if tok.kind == jsEOF {
+			open := stack[len(stack)-1]
+			return nil, false, l.errorf(open.start, "unclosed '%s'", l.text(open))
+		} else if tok.kind != jsPunct {
+			continue
+		}
+
+		switch s := l.text(tok); s {
+		case "{", "[", "(":
+			stack = append(stack, tok)
+		case "}", "]", ")":
+			open := stack[len(stack)-1]
+			if jsClosers[l.text(open)] != s {
+				return nil, false, l.errorf(tok.start, "unexpected '%s', expected '%s' to close '%s' at offset %d", s, jsClosers[l.text(open)], l.text(open), l.base+open.start)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return l.src[t.start:l.pos], true, nil
+}
+
+// findJsAssignments finds every variable declared with var, let or const and
+// every property assigned to window that is given a literal value
+func findJsAssignments(src []byte, base int) ([]jsAssignment, error) {
+	l := &jsLexer{src: src, base: base}
+
+	var assignments []jsAssignment
+
+	// the last few tokens
+	var window [4]jsToken
+
+	// whether the last value completed a declaration that may go on after a
+	// comma, like var a = 1, b = 2
+	afterDecl := false
+	for {
+		t, err := l.next()
+		if err != nil {
+			return assignments, err
+		}
+
+		if t.kind == jsEOF {
+			return assignments, nil
+		}
+
+		copy(window[:], window[1:])
+		window[3] = t
+
+		if !l.isPunct(window[3], "=") || window[2].kind != jsIdent {
+			continue
+		}
+
+		declared := window[1].kind == jsIdent && (l.text(window[1]) == "var" || l.text(window[1]) == "let" || l.text(window[1]) == "const") ||
+			afterDecl && window[0].kind == jsEOF && l.isPunct(window[1], ",")
+		onWindow := l.isPunct(window[1], ".") && window[0].kind == jsIdent && l.text(window[0]) == "window"
+		if !declared && !onWindow {
+			continue
+		}
+
+		name := l.text(window[2])
+
+		valueStart, err := l.next()
+		if err != nil {
+			return assignments, err
+		}
+
+		value, ok, err := l.scanValue(valueStart)
+		if err != nil {
+			return assignments, err
+		}
+
+		if ok {
+			assignments = append(assignments, jsAssignment{name, base + valueStart.start, value})
+		}
+
+		afterDecl = declared && ok
+		window = [4]jsToken{}
+	}
+}
+
+func (l *jsLexer) isPunct(t jsToken, s string) bool {
+	return t.kind == jsPunct && l.text(t) == s
+}
+
+// findPageAssignments finds the inline data assignments in every script on
+// an html page. Syntax errors are only returned if no assignments were found.
+func findPageAssignments(page []byte) ([]jsAssignment, error) {
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+
+	var assignments []jsAssignment
+	var firstErr error
+
+	offset := 0
+	inScript := false
+	for {
+		tokenType := tokenizer.Next()
+		raw := tokenizer.Raw()
+
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		switch tokenType {
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			inScript = string(name) == "script"
+		case html.EndTagToken:
+			inScript = false
+		case html.TextToken:
+			if inScript {
+				found, err := findJsAssignments(raw, offset)
+				assignments = append(assignments, found...)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+
+		offset += len(raw)
+	}
+
+	if len(assignments) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	return assignments, nil
+}
+
+// findPageAssignment returns the value of the named inline data assignment
+func findPageAssignment(page []byte, name string) ([]byte, error) {
+	assignments, err := findPageAssignments(page)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range assignments {
+		if a.Name == name {
+			return a.Value, nil
+		}
+	}
+
+	if len(assignments) == 0 {
+		return nil, fmt.Errorf("js: %s not found in page", name)
+	}
+
+	var names []string
+	for _, a := range assignments {
+		names = append(names, a.Name)
+	}
+
+	return nil, fmt.Errorf("js: %s not found in page, only %s", name, strings.Join(names, ", "))
+}
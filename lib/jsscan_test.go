@@ -0,0 +1,121 @@
+package funimation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindPageAssignment(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{
+			"plain",
+			`<script>var playersData = [{"a":1}];</script>`,
+			`[{"a":1}]`,
+		},
+		{
+			"brackets in strings",
+			`<script>var playersData = [{"a":"]}", 'b':'it\'s [', c: "\"}"}];</script>`,
+			`[{"a":"]}", 'b':'it\'s [', c: "\"}"}]`,
+		},
+		{
+			"decoys in comments",
+			"<script>// var playersData = [1];\n/* var playersData = [2]; */ var playersData = [3];</script>",
+			`[3]`,
+		},
+		{
+			"stray closers before",
+			`<script>if (a) { x = y[0] }] } var playersData = [4];</script>`,
+			`[4]`,
+		},
+		{
+			"regex",
+			`<script>var re = /[\]}]+"/g; var playersData = {"re": 5};</script>`,
+			`{"re": 5}`,
+		},
+		{
+			"apostrophes in html",
+			`<p>Don't stop</p><script>var other = 1, playersData = [6];</script><p>it's over]</p>`,
+			`[6]`,
+		},
+		{
+			"second script",
+			`<script>var broken = "oops</script><script>window.playersData = [7]</script>`,
+			`[7]`,
+		},
+		{
+			"let",
+			`<script>let playersData = [8]
+</script>`,
+			`[8]`,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := findPageAssignment([]byte(test.page), "playersData")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(got) != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindPageAssignments(t *testing.T) {
+	page := `<script>var a = 1; const b = {"x": [1, 2]}; window.c = "str"; window.d = f(); e = [9]; window.location.href = "x";</script>`
+
+	assignments, err := findPageAssignments([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, a := range assignments {
+		got = append(got, a.Name+"="+string(a.Value))
+		if page[a.Offset:a.Offset+len(a.Value)] != string(a.Value) {
+			t.Errorf("%s has the wrong offset %d", a.Name, a.Offset)
+		}
+	}
+
+	if want := `a=1 b={"x": [1, 2]} c="str"`; strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestFindPageAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		page   string
+		err    string
+		offset int
+	}{
+		{`<script>var playersData = [{"a": 1]];</script>`, "unexpected ']', expected '}' to close '{' at offset 27", 34},
+		{`<script>var playersData = [{"a": 1}`, "unclosed '['", 26},
+		{`<script>var playersData = ["abc];</script>`, "unterminated string", 27},
+		{`<script>var x = 1;</script>`, "", 0},
+	}
+
+	for _, test := range tests {
+		_, err := findPageAssignment([]byte(test.page), "playersData")
+		if err == nil {
+			t.Errorf("%s: expected error", test.page)
+			continue
+		}
+
+		if test.err == "" {
+			if !strings.Contains(err.Error(), "not found") {
+				t.Errorf("%s: got %v, want not found", test.page, err)
+			}
+			continue
+		}
+
+		syntaxErr, ok := err.(*JsSyntaxError)
+		if !ok {
+			t.Errorf("%s: got %T %v, want syntax error", test.page, err, err)
+		} else if syntaxErr.Msg != test.err || syntaxErr.Offset != test.offset {
+			t.Errorf("%s: got %q at %d, want %q at %d", test.page, syntaxErr.Msg, syntaxErr.Offset, test.err, test.offset)
+		}
+	}
+}
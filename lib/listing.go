@@ -0,0 +1,71 @@
+package funimation
+
+import (
+	"errors"
+	"strings"
+	"golang.ssttevee.com/funimation/lib/scrape"
+)
+
+// listingRules find the episode cards in the html of a show's listing. When
+// the website's markup changes, these are what need to change with it.
+var listingRules = &scrape.Rules{
+	Card: ".item-cell",
+	Fields: map[string]scrape.Rule{
+		"url":       {Selector: "a.watchLinks", Attr: "href"},
+		"title":     {Selector: "a.watchLinks .title"},
+		"number":    {Selector: ".episode-number", Pattern: `\d+(?:\.\d+)?`},
+		"thumbnail": {Selector: "img.thumbnail", Attr: "src"},
+		"type":      {Selector: "a.watchLinks .badge"},
+		"badges":    {Selector: ".availability li", All: true},
+	},
+}
+
+// watchLinkRules find the episodes of a listing by their links alone, which
+// is all that is certain about its markup. They are used when none of the
+// cards around the links are found, and only know what the link says.
+var watchLinkRules = &scrape.Rules{
+	Card: "a.watchLinks",
+	Fields: map[string]scrape.Rule{
+		"url":   {Attr: "href"},
+		"title": {Selector: ".title"},
+		"type":  {Selector: ".badge"},
+	},
+}
+
+var errNoCards = errors.New("listing: no episode cards found")
+
+// extractCards finds the episode cards in the html of a listing. A listing
+// without any html is empty, but one with html and no episode links in it
+// is markup that isn't understood, and an error.
+func extractCards(main string) ([]scrape.Item, error) {
+	cards, err := listingRules.ExtractFrom(strings.NewReader(main))
+	if err != nil {
+		return nil, err
+	}
+
+	if !haveUrls(cards) {
+		if cards, err = watchLinkRules.ExtractFrom(strings.NewReader(main)); err != nil {
+			return nil, err
+		}
+	}
+
+	if !haveUrls(cards) {
+		if strings.TrimSpace(main) != "" {
+			return nil, errNoCards
+		}
+
+		return nil, nil
+	}
+
+	return cards, nil
+}
+
+func haveUrls(cards []scrape.Item) bool {
+	for _, card := range cards {
+		if card.Get("url") != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package funimation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListingRules(t *testing.T) {
+	main := `<div class="item-cell"><a class="watchLinks" href="http://www.funimation.com/shows/a/videos/official/a-special-day"><img class="thumbnail" src="http://www.funimation.com/a.jpg"><span class="badge">Episode</span> <span class="title">A Special Day</span></a><span class="episode-number">Episode 12.5</span><ul class="availability"><li>SUB</li><li>HD</li></ul></div>`
+
+	cards, err := listingRules.ExtractFrom(strings.NewReader(main))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, want 1", len(cards))
+	}
+
+	card := cards[0]
+	want := map[string]string{
+		"url":       "http://www.funimation.com/shows/a/videos/official/a-special-day",
+		"title":     "A Special Day",
+		"number":    "12.5",
+		"thumbnail": "http://www.funimation.com/a.jpg",
+		"type":      "Episode",
+	}
+
+	for field, value := range want {
+		if card.Get(field) != value {
+			t.Errorf("%s: got %q, want %q", field, card.Get(field), value)
+		}
+	}
+
+	if !reflect.DeepEqual(card["badges"], []string{"SUB", "HD"}) {
+		t.Errorf("got badges %q", card["badges"])
+	}
+}
+
+func TestListingCards(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ep, err := series.GetEpisode(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ep.ThumbnailUrl() != "http://www.funimation.com/thumbnails/MS-episode-1-2.jpg" {
+		t.Errorf("got thumbnail %q", ep.ThumbnailUrl())
+	}
+
+	if !reflect.DeepEqual(ep.Badges(), []string{"SUB", "DUB", "HD"}) {
+		t.Errorf("got badges %q", ep.Badges())
+	}
+}
+
+func TestListingWatchLinks(t *testing.T) {
+	main := `<ul class="episodes"><li><a class="watchLinks" href="http://www.funimation.com/shows/a/videos/official/a-special-day"><span class="badge">OVA</span> <span class="title">A Special Day</span></a></li></ul>`
+
+	cards, err := extractCards(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, want 1", len(cards))
+	}
+
+	if cards[0].Get("url") != "http://www.funimation.com/shows/a/videos/official/a-special-day" || cards[0].Get("type") != "OVA" {
+		t.Errorf("got card %q", cards[0])
+	}
+
+	if _, err := extractCards(`<div class="grid"><span>Nothing to see here</span></div>`); err != errNoCards {
+		t.Errorf("got error %v for a listing without episode links", err)
+	}
+
+	if cards, err := extractCards(""); err != nil || len(cards) != 0 {
+		t.Errorf("got %d cards, error %v for an empty listing", len(cards), err)
+	}
+}
@@ -1,18 +1,16 @@
 package funimation
 
 import (
-	"net/http"
-	"fmt"
 	"io"
-	"bufio"
-	"github.com/hishboy/gocommons/lang"
 	"errors"
 	"encoding/json"
 	"strings"
 	"strconv"
+	"time"
 )
 
 type playerData struct {
+	playerId string
 	showSlug string
 	playlist []playlistItem
 }
@@ -43,8 +41,9 @@ func (x *playlistItemContainer) IAmAPlaylistItem() {
 
 type playlistItemClip struct {
 	basePlaylistItem
-	videoSet []*videoItem
-	number   float32
+	videoSet  []*videoItem
+	videoType string
+	number    float32
 }
 
 func (x *playlistItemClip) IAmAPlaylistItem() {
@@ -58,27 +57,22 @@ type videoItem struct {
 	hdUrl        string
 	languageMode EpisodeLanguage
 	sdUrl        string
+	duration     time.Duration
 }
 
-func getPlayersDataFromUrl(client *http.Client, url string) ([]*playerData, error) {
+func getPlayersDataFromUrl(client *Client, url string) ([]*playerData, error) {
 	if !strings.HasPrefix(url, "http://www.funimation.com") {
 		return nil, errors.New("Url not supported: " + url)
 	}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("User-Agent", mobileUA)
-
-	res, err := client.Do(req)
+	res, err := client.get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return nil, errors.New(fmt.Sprintf("playersData: got status code %d from %s", res.StatusCode, url))
+		return nil, &StatusError{res.StatusCode, url}
 	}
 
 	jsonBytes, err := isolatePlayersDataJson(res.Body)
@@ -90,68 +84,12 @@ func getPlayersDataFromUrl(client *http.Client, url string) ([]*playerData, erro
 }
 
 func isolatePlayersDataJson(rd io.Reader) ([]byte, error) {
-	r := bufio.NewReader(rd)
-
-	stack := lang.NewStack()
-
-	needle := []byte("var playersData = ")
-	matches := 0
-
-	jsonBytes := make([]byte, 0, 1024)
-
-	escaped := false
-	inquote := false
-	for {
-		b, err := r.ReadByte()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		}
-
-		if matches < len(needle) {
-			if b == needle[matches] {
-				matches++
-			} else {
-				matches = 0
-			}
-		} else {
-			if inquote {
-				if escaped {
-					escaped = false
-				} else if b == '\\' {
-					escaped = true
-				} else if b == '"' {
-					inquote = false
-				}
-			} else if b == '"' {
-				inquote = true
-			} else if b == '[' || b == '{' {
-				stack.Push(b)
-			} else if b == ']' {
-				if stack.Peek().(byte) == '[' {
-					stack.Pop()
-				} else {
-					// syntax error...
-					return nil, errors.New("playersdata has syntax error")
-				}
-			} else if b == '}' {
-				if stack.Peek().(byte) == '{' {
-					stack.Pop()
-				} else {
-					// syntax error...
-					return nil, errors.New("playersdata has syntax error")
-				}
-			} else if b == ';' && stack.Len() == 0 {
-				// done!
-				break
-			}
-
-			jsonBytes = append(jsonBytes, b)
-		}
+	page, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
 	}
 
-	return jsonBytes, nil
+	return findPageAssignment(page, "playersData")
 }
 
 func getPlayersData(b []byte) ([]*playerData, error) {
@@ -166,6 +104,10 @@ func getPlayersData(b []byte) ([]*playerData, error) {
 	for _, pd := range dst {
 		dat := &playerData{}
 
+		if playerId, ok := pd["playerId"].(string); ok {
+			dat.playerId = playerId
+		}
+
 		if selectedItemAK, ok := pd["selectedItemAK"]; ok {
 			dat.showSlug = selectedItemAK.(string)
 		}
@@ -283,6 +225,10 @@ func formatPlaylistItemClip(m map[string]interface{}) (playlistItem, error) {
 			vi.languageMode = EpisodeLanguage(lm.(string))
 		}
 
+		if secs, ok := video["duration"].(float64); ok {
+			vi.duration = time.Duration(secs * float64(time.Second))
+		}
+
 		ret.videoSet = append(ret.videoSet, &vi)
 	}
 
@@ -290,6 +236,10 @@ func formatPlaylistItemClip(m map[string]interface{}) (playlistItem, error) {
 		return nil, NotFound
 	}
 
+	if vt, ok := m["videoType"].(string); ok {
+		ret.videoType = vt
+	}
+
 	if n, ok := m["number"]; ok && n != nil {
 		num, err := strconv.ParseFloat(n.(string), 32)
 		if err != nil {
@@ -3,13 +3,16 @@ package funimation
 import (
 	"testing"
 	"fmt"
-	"net/http"
 	"encoding/json"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
 )
 
 func TestIsolatePlayersData(t *testing.T) {
-	url := "http://www.funimation.com/shows/netoge/videos/official/and-you-thought-there-is-never-a-girl-online"
-	res, err := http.Get(url)
+	srv := funimationtest.NewDefaultServer()
+	defer srv.Close()
+
+	url := "http://www.funimation.com/shows/multi-season/videos/official/MS-episode-1-1"
+	res, err := srv.Client().Get(url)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,8 +34,12 @@ func TestIsolatePlayersData(t *testing.T) {
 	t.Log(dst)
 }
 
+// netogePlayersData was taken from the website. Its first episode is a
+// regular one, even though its item class is "recap".
+const netogePlayersData = "[{\"playerId\":\"showsPlayer\",\"userId\":true,\"solution\":\"flash\",\"playlist\":[{\"itemId\":\"5485\",\"itemAK\":\"Season 1\",\"itemType\":\"container\",\"itemClass\":\"season\",\"showId\":\"7556960\",\"showUrl\":\"netoge\",\"artist\":\"And you thought there is never a girl online?\",\"title\":\"Season 1\",\"description\":\"\",\"posterUrl\":null,\"items\":[{\"itemId\":\"33632\",\"itemAK\":\"and-you-thought-there-is-never-a-girl-online\",\"itemType\":\"clip\",\"itemClass\":\"recap\",\"showId\":\"7556960\",\"showUrl\":\"netoge\",\"videoType\":\"official\",\"videoUrl\":\"and-you-thought-there-is-never-a-girl-online\",\"artist\":\"And you thought there is never a girl online?\",\"title\":\"1 - And you thought there is never a girl online?\",\"description\":\"Hardcore otaku Hideki Nishimura enjoys playing a net game with other members of his online guild, and finally agrees to marry one within the game. However, when...\",\"posterUrl\":\"http://www.funimation.com/admin/uploads/default/recap_thumbnails/7556960/videos_spotlight/AYT0001.jpg\",\"favorited\":false,\"enqueued\":false,\"checkpoint\":0,\"videoSet\":[{\"videoId\":\"61269\",\"videoType\":\"official\",\"languageMode\":\"sub\",\"authToken\":\"?S9bgFtVlquI_pkPz3m-Hw3cvCnuOBf1AEfQjCSI36_jmY_NzXn5aLsnsyR-JSW5avaMj94iFAAQOTxnrPE_wF2bNh3VQSg28I1DZBQpAMnRNfMh3KWfjWN58rBcWGXsjSJBOqbTT2KIdPJmHMZ7m_g\",\"aspectRatio\":\"16:9\",\"duration\":1482,\"AIPs\":[],\"sdUrl\":\"http://wpc.8c48.edgecastcdn.net/038C48/SV/480/AYTJPNFSipon0001/AYTJPNFSipon0001-480-,750,1500,K.mp4.m3u8\",\"hdUrl\":\"nonSubscription\",\"hd1080Url\":\"nonSubscription\",\"huluId\":null,\"exclusive\":false,\"adSupported\":false,\"closedCaptions\":false,\"ccUrl\":null,\"videoNumber\":\"1.0\",\"title\":\"And you thought there is never a girl online?\",\"royalID\":\"SM-00000\",\"contractID\":\"1729\",\"videoAction\":\"Free Streaming\",\"FUNImationID\":\"AYTJPNFSipon0001\"}],\"number\":\"1.0\"},{\"itemType\":\"clip\",\"title\":\"2 - I thought we couldn't play net games at school?\",\"description\":\"Having met his other in-game guild members in real life, Hideki begins to picture them in their characters' places. Ako's behavior at school the next day makes ...\",\"videoUrl\":\"http://www.funimation.com/shows/netoge/videos/official/i-thought-we-couldnt-play-net-games-at-school\",\"number\":\"2.0\",\"posterUrl\":\"http://www.funimation.com/admin/uploads/default/recap_thumbnails/7556960/videos_spotlight/AYT0002.jpg\"}]}],\"selectedItemAK\":\"and-you-thought-there-is-never-a-girl-online\",\"selectedItemCheckpoint\":\"0\",\"size\":\"large\",\"mode\":\"full\",\"languageMode\":\"sub\",\"qualityMode\":\"sd\",\"autoPlay\":false,\"IDuser\":\"2629531\",\"userRole\":\"Past Subscriber\"}]"
+
 func TestGetPlayersData(t *testing.T) {
-	jsonBytes := []byte("[{\"playerId\":\"showsPlayer\",\"userId\":true,\"solution\":\"flash\",\"playlist\":[{\"itemId\":\"5485\",\"itemAK\":\"Season 1\",\"itemType\":\"container\",\"itemClass\":\"season\",\"showId\":\"7556960\",\"showUrl\":\"netoge\",\"artist\":\"And you thought there is never a girl online?\",\"title\":\"Season 1\",\"description\":\"\",\"posterUrl\":null,\"items\":[{\"itemId\":\"33632\",\"itemAK\":\"and-you-thought-there-is-never-a-girl-online\",\"itemType\":\"clip\",\"itemClass\":\"recap\",\"showId\":\"7556960\",\"showUrl\":\"netoge\",\"videoType\":\"official\",\"videoUrl\":\"and-you-thought-there-is-never-a-girl-online\",\"artist\":\"And you thought there is never a girl online?\",\"title\":\"1 - And you thought there is never a girl online?\",\"description\":\"Hardcore otaku Hideki Nishimura enjoys playing a net game with other members of his online guild, and finally agrees to marry one within the game. However, when...\",\"posterUrl\":\"http://www.funimation.com/admin/uploads/default/recap_thumbnails/7556960/videos_spotlight/AYT0001.jpg\",\"favorited\":false,\"enqueued\":false,\"checkpoint\":0,\"videoSet\":[{\"videoId\":\"61269\",\"videoType\":\"official\",\"languageMode\":\"sub\",\"authToken\":\"?S9bgFtVlquI_pkPz3m-Hw3cvCnuOBf1AEfQjCSI36_jmY_NzXn5aLsnsyR-JSW5avaMj94iFAAQOTxnrPE_wF2bNh3VQSg28I1DZBQpAMnRNfMh3KWfjWN58rBcWGXsjSJBOqbTT2KIdPJmHMZ7m_g\",\"aspectRatio\":\"16:9\",\"duration\":1482,\"AIPs\":[],\"sdUrl\":\"http://wpc.8c48.edgecastcdn.net/038C48/SV/480/AYTJPNFSipon0001/AYTJPNFSipon0001-480-,750,1500,K.mp4.m3u8\",\"hdUrl\":\"nonSubscription\",\"hd1080Url\":\"nonSubscription\",\"huluId\":null,\"exclusive\":false,\"adSupported\":false,\"closedCaptions\":false,\"ccUrl\":null,\"videoNumber\":\"1.0\",\"title\":\"And you thought there is never a girl online?\",\"royalID\":\"SM-00000\",\"contractID\":\"1729\",\"videoAction\":\"Free Streaming\",\"FUNImationID\":\"AYTJPNFSipon0001\"}],\"number\":\"1.0\"},{\"itemType\":\"clip\",\"title\":\"2 - I thought we couldn't play net games at school?\",\"description\":\"Having met his other in-game guild members in real life, Hideki begins to picture them in their characters' places. Ako's behavior at school the next day makes ...\",\"videoUrl\":\"http://www.funimation.com/shows/netoge/videos/official/i-thought-we-couldnt-play-net-games-at-school\",\"number\":\"2.0\",\"posterUrl\":\"http://www.funimation.com/admin/uploads/default/recap_thumbnails/7556960/videos_spotlight/AYT0002.jpg\"}]}],\"selectedItemAK\":\"and-you-thought-there-is-never-a-girl-online\",\"selectedItemCheckpoint\":\"0\",\"size\":\"large\",\"mode\":\"full\",\"languageMode\":\"sub\",\"qualityMode\":\"sd\",\"autoPlay\":false,\"IDuser\":\"2629531\",\"userRole\":\"Past Subscriber\"}]")
+	jsonBytes := []byte(netogePlayersData)
 
 	playersData, err := getPlayersData(jsonBytes)
 	if err != nil {
@@ -63,5 +70,42 @@ func TestGetPlayersData(t *testing.T) {
 }
 
 func TestGetPlayersDataFromUrl(t *testing.T) {
+	srv := funimationtest.NewDefaultServer()
+	defer srv.Close()
+
+	playersData, err := getPlayersDataFromUrl(NewWithHttpClient(srv.Client()), "http://www.funimation.com/shows/multi-season/videos/official/MS-episode-2-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(playersData) != 1 {
+		t.Fatalf("got %d players, want 1", len(playersData))
+	}
+
+	if playersData[0].showSlug != "MS-episode-2-3" {
+		t.Errorf("got selected item %q", playersData[0].showSlug)
+	}
 
+	// seasons without the current episode have no videos and are left out
+	if n := len(playersData[0].playlist); n != 1 {
+		t.Fatalf("got %d seasons, want 1", n)
+	}
+
+	season := playersData[0].playlist[0].(*playlistItemContainer)
+	if season.title != "Season 2" {
+		t.Errorf("got %q, want Season 2", season.title)
+	}
+
+	if len(season.items) != 1 {
+		t.Fatalf("got %d clips with videos, want 1", len(season.items))
+	}
+
+	clip := season.items[0].(*playlistItemClip)
+	if clip.number != 3 || len(clip.videoSet) != 2 {
+		t.Errorf("got episode %v with %d videos, want episode 3 with 2 videos", clip.number, len(clip.videoSet))
+	}
+
+	if _, err := getPlayersDataFromUrl(NewWithHttpClient(srv.Client()), "http://www.funimation.com/shows/multi-season/videos/official/nope"); err == nil {
+		t.Error("expected error for missing episode")
+	}
 }
\ No newline at end of file
@@ -0,0 +1,184 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// how often bars are redrawn for bytes events
+const redrawInterval = 200 * time.Millisecond
+
+type barJob struct {
+	name    string
+	status  string
+	attempt int
+	current int64
+	size    int64
+	err     error
+
+	rate               float64
+	lastTime           time.Time
+	bytesSinceLastTime int64
+}
+
+// Bars draws one progress bar per job on a terminal, redrawing them in place
+type Bars struct {
+	w io.Writer
+
+	mu       sync.Mutex
+	jobs     []*barJob
+	byName   map[string]*barJob
+	lines    int
+	lastDraw time.Time
+}
+
+func NewBars(w io.Writer) *Bars {
+	return &Bars{
+		w:      w,
+		byName: make(map[string]*barJob),
+	}
+}
+
+func (b *Bars) job(name string) *barJob {
+	job, ok := b.byName[name]
+	if !ok {
+		job = &barJob{name: name}
+		b.byName[name] = job
+		b.jobs = append(b.jobs, job)
+	}
+
+	return job
+}
+
+func (b *Bars) Started(name string, attempt int, size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := b.job(name)
+	job.status = "downloading"
+	job.attempt = attempt
+	job.size = size
+	job.current = 0
+	job.rate = 0
+	job.lastTime = time.Now()
+
+	b.draw()
+}
+
+func (b *Bars) Bytes(name string, current, size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := b.job(name)
+	if current > job.current {
+		job.bytesSinceLastTime += current - job.current
+	}
+	job.current = current
+	job.size = size
+
+	newTime := time.Now()
+	if secs := newTime.Sub(job.lastTime).Seconds(); secs >= 0.5 {
+		job.rate = float64(job.bytesSinceLastTime) / secs
+		job.lastTime = newTime
+		job.bytesSinceLastTime = 0
+	}
+
+	if newTime.Sub(b.lastDraw) >= redrawInterval {
+		b.draw()
+	}
+}
+
+func (b *Bars) Finished(name string, size int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := b.job(name)
+	job.status = "done"
+	job.current = size
+
+	b.draw()
+}
+
+func (b *Bars) Failed(name string, err error, retrying bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	job := b.job(name)
+	job.err = err
+	if retrying {
+		job.status = "retrying"
+	} else {
+		job.status = "failed"
+	}
+
+	b.draw()
+}
+
+func (b *Bars) draw() {
+	if b.lines > 0 {
+		fmt.Fprintf(b.w, "\033[%dA", b.lines)
+	}
+
+	nameLen := 0
+	for _, job := range b.jobs {
+		if len(job.name) > nameLen {
+			nameLen = len(job.name)
+		}
+	}
+
+	for _, job := range b.jobs {
+		fmt.Fprintf(b.w, "\r\033[K%-*s %s\n", nameLen, job.name, job.line())
+	}
+
+	b.lines = len(b.jobs)
+	b.lastDraw = time.Now()
+}
+
+func (job *barJob) line() string {
+	switch job.status {
+	case "done":
+		return fmt.Sprintf("done, %s", humanize.Bytes(uint64(job.current)))
+	case "failed", "retrying":
+		return fmt.Sprintf("%s (attempt %d): %v", job.status, job.attempt, job.err)
+	}
+
+	var percent float32
+	if job.size > 0 {
+		percent = float32(job.current) / float32(job.size)
+	}
+
+	percentStr := fmt.Sprintf("%.2f", percent * float32(100))
+	for ; len(percentStr) < 6; {
+		percentStr = " " + percentStr
+	}
+
+	progBar := "["
+	progBarLen := 30
+	for i := 0; i < progBarLen; i++ {
+		if float32(i) < float32(progBarLen) * percent {
+			if progBar[len(progBar) - 1] == byte('>') {
+				progBar = progBar[:len(progBar) - 1] + "="
+			}
+			progBar += ">"
+		} else {
+			progBar += " "
+		}
+	}
+	progBar += "]"
+
+	bytesStr := humanize.Comma(job.current)
+	for ; len(bytesStr) < len(humanize.Comma(job.size)); {
+		bytesStr = " " + bytesStr
+	}
+
+	rateStr := humanize.Bytes(uint64(job.rate))
+	for ; len(rateStr) < 10; {
+		rateStr = " " + rateStr
+	}
+
+	return fmt.Sprintf("%s%% %s %s %s/s", percentStr, progBar, bytesStr, rateStr)
+}
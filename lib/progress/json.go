@@ -0,0 +1,70 @@
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type jsonEvent struct {
+	Event    string    `json:"event"`
+	Job      string    `json:"job"`
+	Time     time.Time `json:"time"`
+	Attempt  int       `json:"attempt,omitempty"`
+	Current  int64     `json:"current,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Retrying bool      `json:"retrying,omitempty"`
+}
+
+// JSON writes every event as a line of json for other programs to consume.
+// Bytes events are limited to one per job per Interval.
+type JSON struct {
+	Interval time.Duration
+
+	mu    sync.Mutex
+	enc   *json.Encoder
+	times map[string]time.Time
+}
+
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{
+		Interval: time.Second,
+		enc:      json.NewEncoder(w),
+		times:    make(map[string]time.Time),
+	}
+}
+
+func (j *JSON) write(e *jsonEvent) {
+	e.Time = time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if e.Event == "bytes" {
+		if e.Time.Sub(j.times[e.Job]) < j.Interval {
+			return
+		}
+
+		j.times[e.Job] = e.Time
+	}
+
+	j.enc.Encode(e)
+}
+
+func (j *JSON) Started(job string, attempt int, size int64) {
+	j.write(&jsonEvent{Event: "started", Job: job, Attempt: attempt, Size: size})
+}
+
+func (j *JSON) Bytes(job string, current, size int64) {
+	j.write(&jsonEvent{Event: "bytes", Job: job, Current: current, Size: size})
+}
+
+func (j *JSON) Finished(job string, size int64) {
+	j.write(&jsonEvent{Event: "finished", Job: job, Current: size, Size: size})
+}
+
+func (j *JSON) Failed(job string, err error, retrying bool) {
+	j.write(&jsonEvent{Event: "failed", Job: job, Error: err.Error(), Retrying: retrying})
+}
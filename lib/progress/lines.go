@@ -0,0 +1,72 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Lines writes a line for every started, finished and failed event, and for
+// every tenth of a job that is received. It suits logs and other outputs
+// that are not terminals.
+type Lines struct {
+	w io.Writer
+
+	mu     sync.Mutex
+	tenths map[string]int64
+}
+
+func NewLines(w io.Writer) *Lines {
+	return &Lines{
+		w:      w,
+		tenths: make(map[string]int64),
+	}
+}
+
+func (l *Lines) Started(job string, attempt int, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tenths[job] = 0
+
+	if size > 0 {
+		fmt.Fprintf(l.w, "%s: started attempt %d, %s\n", job, attempt, humanize.Bytes(uint64(size)))
+	} else {
+		fmt.Fprintf(l.w, "%s: started attempt %d\n", job, attempt)
+	}
+}
+
+func (l *Lines) Bytes(job string, current, size int64) {
+	if size <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if tenth := current * 10 / size; tenth > l.tenths[job] && tenth < 10 {
+		l.tenths[job] = tenth
+		fmt.Fprintf(l.w, "%s: %d%% (%s of %s)\n", job, tenth*10, humanize.Bytes(uint64(current)), humanize.Bytes(uint64(size)))
+	}
+}
+
+func (l *Lines) Finished(job string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.tenths, job)
+	fmt.Fprintf(l.w, "%s: finished, %s\n", job, humanize.Bytes(uint64(size)))
+}
+
+func (l *Lines) Failed(job string, err error, retrying bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if retrying {
+		fmt.Fprintf(l.w, "%s: failed, retrying: %v\n", job, err)
+	} else {
+		fmt.Fprintf(l.w, "%s: failed: %v\n", job, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Package progress reports the progress of download jobs to a user or to
+// another program.
+package progress // import "golang.ssttevee.com/funimation/lib/progress"
+
+import (
+	"io"
+	"os"
+)
+
+// Reporter receives the events of any number of jobs, which are told apart
+// by name. Implementations must be safe for concurrent use.
+type Reporter interface {
+	// Started is called every time a job is attempted, size is 0 if it is
+	// not known
+	Started(job string, attempt int, size int64)
+
+	// Bytes is called as data is received with the total received so far
+	Bytes(job string, current, size int64)
+
+	// Finished is called once a job has completed successfully
+	Finished(job string, size int64)
+
+	// Failed is called when an attempt fails, retrying tells whether the job
+	// will be attempted again
+	Failed(job string, err error, retrying bool)
+}
+
+// Discard is a Reporter that ignores every event
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Started(string, int, int64) {}
+func (discard) Bytes(string, int64, int64) {}
+func (discard) Finished(string, int64)     {}
+func (discard) Failed(string, error, bool) {}
+
+// IsTerminal reports whether w is a terminal that can display progress bars
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// New returns progress bars if w is a terminal or plain lines otherwise
+func New(w io.Writer) Reporter {
+	if IsTerminal(w) {
+		return NewBars(w)
+	}
+
+	return NewLines(w)
+}
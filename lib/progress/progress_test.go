@@ -0,0 +1,80 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLines(&buf)
+
+	l.Started("ep1", 1, 1000)
+	for i := int64(0); i <= 1000; i += 50 {
+		l.Bytes("ep1", i, 1000)
+	}
+	l.Failed("ep1", errors.New("boom"), true)
+	l.Started("ep1", 2, 1000)
+	l.Bytes("ep1", 550, 1000)
+	l.Finished("ep1", 1000)
+
+	want := []string{
+		"ep1: started attempt 1, 1.0 kB",
+		"ep1: 10% (100 B of 1.0 kB)",
+		"ep1: 20% (200 B of 1.0 kB)",
+		"ep1: 30% (300 B of 1.0 kB)",
+		"ep1: 40% (400 B of 1.0 kB)",
+		"ep1: 50% (500 B of 1.0 kB)",
+		"ep1: 60% (600 B of 1.0 kB)",
+		"ep1: 70% (700 B of 1.0 kB)",
+		"ep1: 80% (800 B of 1.0 kB)",
+		"ep1: 90% (900 B of 1.0 kB)",
+		"ep1: failed, retrying: boom",
+		"ep1: started attempt 2, 1.0 kB",
+		"ep1: 50% (550 B of 1.0 kB)",
+		"ep1: finished, 1.0 kB",
+	}
+
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSON(&buf)
+
+	j.Started("ep1", 1, 1000)
+	j.Bytes("ep1", 100, 1000)
+	j.Bytes("ep1", 200, 1000) // too soon, dropped
+	j.Bytes("ep2", 300, 1000)
+	j.Failed("ep2", errors.New("boom"), false)
+	j.Finished("ep1", 1000)
+
+	var events []jsonEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e jsonEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, e)
+	}
+
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Event+":"+e.Job)
+	}
+
+	if want := "started:ep1 bytes:ep1 bytes:ep2 failed:ep2 finished:ep1"; strings.Join(got, " ") != want {
+		t.Errorf("got events %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if events[3].Error != "boom" || events[3].Retrying {
+		t.Errorf("unexpected failed event: %+v", events[3])
+	}
+}
@@ -0,0 +1,85 @@
+// Package rate implements a token bucket for limiting how often something
+// may happen, such as bytes read or requests made.
+package rate // import "golang.ssttevee.com/funimation/lib/rate"
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket that refills at a fixed rate up to its burst
+// size. It is safe for concurrent use.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket that refills at rate tokens per second
+// and holds at most burst tokens. A rate of 0 means no limit.
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *Bucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.rate
+}
+
+func (b *Bucket) SetRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.rate = rate
+}
+
+func (b *Bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+}
+
+// Reserve takes n tokens from the bucket and returns how long to wait
+// before they may be used. n may be larger than the burst size, in which
+// case the bucket goes into debt that later callers also wait for.
+func (b *Bucket) Reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait takes n tokens from the bucket, blocking until they are available
+func (b *Bucket) Wait(n int) {
+	if d := b.Reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
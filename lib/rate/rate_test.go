@@ -0,0 +1,30 @@
+package rate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	b := NewBucket(100, 10)
+
+	// the burst is free
+	if d := b.Reserve(10); d != 0 {
+		t.Errorf("expected no wait for burst, got %v", d)
+	}
+
+	// 50 more tokens need half a second at 100 per second
+	if d := b.Reserve(50); d < 450*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("expected about 500ms wait, got %v", d)
+	}
+
+	// and later callers wait for the debt too
+	if d := b.Reserve(1); d < 450*time.Millisecond {
+		t.Errorf("expected to wait for previous debt, got %v", d)
+	}
+
+	b.SetRate(0)
+	if d := b.Reserve(1000); d != 0 {
+		t.Errorf("expected no wait without limit, got %v", d)
+	}
+}
@@ -0,0 +1,56 @@
+// Package redact removes auth tokens, cookies and user ids from responses
+// of the website, so that they may be shared.
+package redact // import "golang.ssttevee.com/funimation/lib/redact"
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+)
+
+// Redacted replaces whatever was removed
+const Redacted = "REDACTED"
+
+// Headers that identify the user, or that change on every request and would
+// clutter diffs
+var Headers = []string{"Set-Cookie", "Cookie", "Authorization", "Date", "Expires", "Age"}
+
+var (
+	authTokenRe  = regexp.MustCompile(`("authToken"\s*:\s*")[^"]*(")`)
+	userIdRe     = regexp.MustCompile(`("(?:IDuser|userId|user_id)"\s*:\s*)("[^"]*"|\d+|true|false)`)
+	videoQueryRe = regexp.MustCompile(`(\.(?:mp4|m3u8|ts))\?[^"'\s<>\\]+`)
+)
+
+// Body removes auth tokens, user ids and the query strings of video urls
+// from a response body
+func Body(b []byte) []byte {
+	b = authTokenRe.ReplaceAll(b, []byte(`${1}?`+Redacted+`${2}`))
+	b = userIdRe.ReplaceAll(b, []byte(`${1}"`+Redacted+`"`))
+	b = videoQueryRe.ReplaceAll(b, []byte(`${1}?`+Redacted))
+	return b
+}
+
+// Url removes the query string from video urls, where the auth token is kept
+func Url(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.RawQuery == "" {
+		return rawUrl
+	}
+
+	if ext := filepath.Ext(u.Path); ext == ".mp4" || ext == ".m3u8" || ext == ".ts" {
+		u.RawQuery = Redacted
+	}
+
+	return u.String()
+}
+
+// Header returns a copy of h without the headers that identify the user
+func Header(h http.Header) http.Header {
+	h = h.Clone()
+	for _, key := range Headers {
+		h.Del(key)
+	}
+
+	return h
+}
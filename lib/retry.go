@@ -0,0 +1,146 @@
+package funimation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// StatusError is returned when the website answers with a status other than
+// 200. A 404 is also NotFound.
+type StatusError struct {
+	Code int
+	Url  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("funimation: got status %d from %s", e.Code, e.Url)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == NotFound && e.Code == http.StatusNotFound
+}
+
+// RetryPolicy decides which failed requests are made again, and how long to
+// wait before each attempt
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 1 or less never retries
+	MaxAttempts int
+
+	// Backoff is the wait before the second attempt, which doubles for each
+	// attempt after that up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each wait that is random, from 0 to 1, so
+	// that many clients don't all retry at the same moment
+	Jitter float64
+
+	// Statuses are the response statuses to retry. A Retry-After header on
+	// the response is honored if it asks for a longer wait.
+	Statuses []int
+
+	// RetryError reports whether a request that failed with err should be
+	// retried, or is nil to retry timeouts and dropped connections
+	RetryError func(err error) bool
+}
+
+// DefaultRetryPolicy retries timeouts, dropped connections, rate limiting and
+// server errors twice
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	Jitter:      0.5,
+	Statuses:    []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+}
+
+// SetRetryPolicy changes which requests are retried. The zero policy turns
+// retries off.
+func (f *Client) SetRetryPolicy(policy RetryPolicy) {
+	f.retry = policy
+}
+
+// isTransient reports whether an error is likely to go away on its own
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// wait returns how long to wait before the attempt after the given one, and
+// whether there should be one at all
+func (p *RetryPolicy) wait(attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	if err != nil {
+		retryError := p.RetryError
+		if retryError == nil {
+			retryError = isTransient
+		}
+
+		if !retryError(err) {
+			return 0, false
+		}
+	} else {
+		retry := false
+		for _, status := range p.Statuses {
+			if res.StatusCode == status {
+				retry = true
+			}
+		}
+
+		if !retry {
+			return 0, false
+		}
+	}
+
+	backoff := p.Backoff << uint(attempt - 1)
+	if backoff > p.MaxBackoff && p.MaxBackoff > 0 || backoff < 0 {
+		backoff = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		backoff -= time.Duration(p.Jitter * rand.Float64() * float64(backoff))
+	}
+
+	if res != nil {
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok && retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+
+	return backoff, true
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or a date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
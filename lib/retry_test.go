@@ -0,0 +1,109 @@
+package funimation
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+func fastRetries(attempts int) RetryPolicy {
+	policy := DefaultRetryPolicy
+	policy.MaxAttempts = attempts
+	policy.Backoff = time.Millisecond
+	return policy
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure *funimationtest.Failure
+		policy  RetryPolicy
+		status  int
+	}{
+		{"unavailable", &funimationtest.Failure{Path: "/shows/viewAllFiltered", Count: 2, Status: http.StatusServiceUnavailable}, fastRetries(3), 0},
+		{"connection reset", &funimationtest.Failure{Path: "/shows/viewAllFiltered", Count: 1}, fastRetries(3), 0},
+		{"too many failures", &funimationtest.Failure{Path: "/shows/viewAllFiltered", Count: 3, Status: http.StatusBadGateway}, fastRetries(3), http.StatusBadGateway},
+		{"not retried", &funimationtest.Failure{Path: "/shows/viewAllFiltered", Count: 1, Status: http.StatusForbidden}, fastRetries(3), http.StatusForbidden},
+		{"retries off", &funimationtest.Failure{Path: "/shows/viewAllFiltered", Count: 1, Status: http.StatusServiceUnavailable}, RetryPolicy{}, http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		client, srv := newTestClient(t)
+		client.SetRetryPolicy(test.policy)
+
+		series, err := client.GetSeries("multi-season")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		srv.Fail(test.failure)
+
+		_, err = series.GetAllEpisodes()
+
+		var statusErr *StatusError
+		if test.status == 0 && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if test.status != 0 && (!errors.As(err, &statusErr) || statusErr.Code != test.status) {
+			t.Errorf("%s: got %v, want status %d", test.name, err, test.status)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	client, srv := newTestClient(t)
+	client.SetRetryPolicy(fastRetries(2))
+
+	srv.Fail(&funimationtest.Failure{Path: "/frontend_api/getShow/", Count: 1, Status: http.StatusTooManyRequests, RetryAfter: "1"})
+
+	start := time.Now()
+	if _, err := client.GetSeries("multi-season"); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least a second", elapsed)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 3 * time.Second, Statuses: []int{503}}
+	res := &http.Response{StatusCode: 503, Header: http.Header{}}
+
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if wait, ok := policy.wait(attempt+1, res, nil); !ok || wait != want {
+			t.Errorf("attempt %d: got %v, want %v", attempt+1, wait, want)
+		}
+	}
+
+	if _, ok := policy.wait(5, res, nil); ok {
+		t.Error("expected no more attempts after the last")
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if wait, _ := policy.wait(1, res, nil); wait < time.Second/2 || wait > time.Second {
+			t.Fatalf("got wait %v with jitter", wait)
+		}
+	}
+
+	res.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if wait, _ := policy.wait(1, res, nil); wait < 58*time.Second {
+		t.Errorf("got wait %v, want about a minute", wait)
+	}
+}
+
+func TestStatusErrorIsNotFound(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	_, err := client.GetEpisodeFromUrl("http://www.funimation.com/shows/multi-season/videos/official/nope")
+	if !errors.Is(err, NotFound) {
+		t.Errorf("got %v, want NotFound", err)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Errorf("got %v, want a status error", err)
+	}
+}
@@ -0,0 +1,185 @@
+package scrape
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"golang.org/x/net/html"
+)
+
+// Rule says where to find a field within a card
+type Rule struct {
+	// Selector finds the element relative to the card, or is empty for the
+	// card itself
+	Selector string
+
+	// Attr is the attribute to read, or empty for the element's text
+	Attr string
+
+	// Pattern, if set, keeps the first group it matches, or its whole match
+	// if it has no groups. Values it doesn't match are dropped.
+	Pattern string
+
+	// All reads every matching element instead of only the first
+	All bool
+}
+
+// Rules extract fields from every card in a document. A card is an element
+// matched by Card, such as an item in a listing.
+type Rules struct {
+	Card   string
+	Fields map[string]Rule
+}
+
+// Item holds the values found for each field of a card
+type Item map[string][]string
+
+// Get returns the first value of a field, or an empty string if there is none
+func (i Item) Get(field string) string {
+	if values := i[field]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+type compiledRule struct {
+	field    string
+	selector *Selector
+	attr     string
+	pattern  *regexp.Regexp
+	all      bool
+}
+
+func (r *Rules) compile() (*Selector, []*compiledRule, error) {
+	card, err := Compile(r.Card)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rules []*compiledRule
+	for field, rule := range r.Fields {
+		cr := &compiledRule{field: field, attr: rule.Attr, all: rule.All}
+
+		if rule.Selector != "" {
+			if cr.selector, err = Compile(rule.Selector); err != nil {
+				return nil, nil, fmt.Errorf("scrape: field %s: %v", field, err)
+			}
+		}
+
+		if rule.Pattern != "" {
+			if cr.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, nil, fmt.Errorf("scrape: field %s: %v", field, err)
+			}
+		}
+
+		rules = append(rules, cr)
+	}
+
+	return card, rules, nil
+}
+
+// Extract finds every card under root and reads its fields
+func (r *Rules) Extract(root *html.Node) ([]Item, error) {
+	card, rules, err := r.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for _, n := range card.FindAll(root) {
+		item := make(Item)
+		for _, rule := range rules {
+			if values := rule.extract(n); len(values) > 0 {
+				item[rule.field] = values
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// ExtractFrom parses an html document or fragment and extracts its cards
+func (r *Rules) ExtractFrom(rd io.Reader) ([]Item, error) {
+	root, err := html.Parse(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Extract(root)
+}
+
+func (r *compiledRule) extract(card *html.Node) []string {
+	nodes := []*html.Node{card}
+	if r.selector != nil {
+		if r.all {
+			nodes = r.selector.FindAll(card)
+		} else if n := r.selector.Find(card); n != nil {
+			nodes = []*html.Node{n}
+		} else {
+			nodes = nil
+		}
+	}
+
+	var values []string
+	for _, n := range nodes {
+		var value string
+		if r.attr == "" {
+			value = Text(n)
+		} else if v, ok := Attr(n, r.attr); ok {
+			value = v
+		} else {
+			continue
+		}
+
+		if r.pattern != nil {
+			m := r.pattern.FindStringSubmatch(value)
+			if m == nil {
+				continue
+			}
+
+			value = m[0]
+			if len(m) > 1 {
+				value = m[1]
+			}
+		}
+
+		values = append(values, value)
+	}
+
+	return values
+}
+
+// Text returns the text inside a node with runs of whitespace collapsed
+func Text(n *html.Node) string {
+	var b strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+
+	walk(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Attr returns the value of an attribute of an element
+func Attr(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+
+	return "", false
+}
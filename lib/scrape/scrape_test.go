@@ -0,0 +1,112 @@
+package scrape
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"golang.org/x/net/html"
+)
+
+const listing = `<div class="list">
+	<div class="item-cell" id="first">
+		<a class="watchLinks" href="/shows/a/videos/official/one"><span class="badge">OVA</span> <span class="title">One</span></a>
+		<ul class="availability"><li>SUB</li><li>DUB</li></ul>
+	</div>
+	<div class="item-cell featured">
+		<a class="watchLinks" href="/shows/a/videos/official/two" data-number="2"><span class="title">Two</span></a>
+		<p>Episode <b>2</b></p>
+	</div>
+</div>`
+
+func parse(t *testing.T, s string) *html.Node {
+	root, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestSelector(t *testing.T) {
+	root := parse(t, listing)
+
+	tests := []struct {
+		selector string
+		texts    []string
+	}{
+		{".title", []string{"One", "Two"}},
+		{"div.item-cell > a .title", []string{"One", "Two"}},
+		{".list > a", nil},
+		{"#first .badge", []string{"OVA"}},
+		{".item-cell.featured .title", []string{"Two"}},
+		{"a[data-number]", []string{"Two"}},
+		{"a[href$=two] span", []string{"Two"}},
+		{"a[href*='official/o']", []string{"OVA One"}},
+		{"li, .badge", []string{"OVA", "SUB", "DUB"}},
+		{"*[class~=badge]", []string{"OVA"}},
+	}
+
+	for _, test := range tests {
+		s, err := Compile(test.selector)
+		if err != nil {
+			t.Errorf("%s: %v", test.selector, err)
+			continue
+		}
+
+		var texts []string
+		for _, n := range s.FindAll(root) {
+			texts = append(texts, Text(n))
+		}
+
+		if !reflect.DeepEqual(texts, test.texts) {
+			t.Errorf("%s: got %q, want %q", test.selector, texts, test.texts)
+		}
+	}
+}
+
+func TestSelectorSyntaxError(t *testing.T) {
+	for _, selector := range []string{"", "a >", "a[href", "a[href=']", ".", "a,", "a!"} {
+		if _, err := Compile(selector); err == nil {
+			t.Errorf("%q: expected an error", selector)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%q: got %T, want *SyntaxError", selector, err)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	rules := &Rules{
+		Card: ".item-cell",
+		Fields: map[string]Rule{
+			"url":    {Selector: "a.watchLinks", Attr: "href"},
+			"title":  {Selector: ".title"},
+			"type":   {Selector: ".badge"},
+			"number": {Selector: "p", Pattern: `Episode (\d+)`},
+			"badges": {Selector: ".availability li", All: true},
+			"id":     {Attr: "id"},
+		},
+	}
+
+	items, err := rules.ExtractFrom(strings.NewReader(listing))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Item{
+		{"url": {"/shows/a/videos/official/one"}, "title": {"One"}, "type": {"OVA"}, "badges": {"SUB", "DUB"}, "id": {"first"}},
+		{"url": {"/shows/a/videos/official/two"}, "title": {"Two"}, "number": {"2"}},
+	}
+
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("got %v, want %v", items, want)
+	}
+
+	if items[1].Get("type") != "" || items[1].Get("number") != "2" {
+		t.Errorf("got type %q and number %q", items[1].Get("type"), items[1].Get("number"))
+	}
+
+	rules.Fields["bad"] = Rule{Selector: "a["}
+	if _, err := rules.ExtractFrom(strings.NewReader(listing)); err == nil {
+		t.Error("expected an error for a bad rule")
+	}
+}
@@ -0,0 +1,367 @@
+// Package scrape finds elements in html documents with css selectors and
+// extracts fields from them with declarative rules.
+package scrape // import "golang.ssttevee.com/funimation/lib/scrape"
+
+import (
+	"fmt"
+	"strings"
+	"golang.org/x/net/html"
+)
+
+// SyntaxError is returned when a selector can't be parsed
+type SyntaxError struct {
+	Selector string
+	Offset   int
+	Msg      string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("scrape: %s at offset %d in %q", e.Msg, e.Offset, e.Selector)
+}
+
+type attrMatcher struct {
+	key string
+	op  string
+	val string
+}
+
+func (m attrMatcher) match(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" || attr.Key != m.key {
+			continue
+		}
+
+		switch m.op {
+		case "":
+			return true
+		case "=":
+			return attr.Val == m.val
+		case "~=":
+			for _, word := range strings.Fields(attr.Val) {
+				if word == m.val {
+					return true
+				}
+			}
+			return false
+		case "^=":
+			return m.val != "" && strings.HasPrefix(attr.Val, m.val)
+		case "$=":
+			return m.val != "" && strings.HasSuffix(attr.Val, m.val)
+		case "*=":
+			return m.val != "" && strings.Contains(attr.Val, m.val)
+		}
+	}
+
+	return false
+}
+
+// compound is a run of simple selectors that must all match one element,
+// like a.watchLinks[href]
+type compound struct {
+	tag   string
+	attrs []attrMatcher
+}
+
+func (c *compound) match(n *html.Node) bool {
+	if n.Type != html.ElementNode || c.tag != "" && c.tag != n.Data {
+		return false
+	}
+
+	for _, attr := range c.attrs {
+		if !attr.match(n) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// complexSelector is compounds joined by combinators, where combinators[i]
+// is between parts[i] and parts[i+1] and is either ' ' or '>'
+type complexSelector struct {
+	parts       []*compound
+	combinators []byte
+}
+
+func (s *complexSelector) match(n *html.Node, i int) bool {
+	if !s.parts[i].match(n) {
+		return false
+	} else if i == 0 {
+		return true
+	}
+
+	if s.combinators[i-1] == '>' {
+		return n.Parent != nil && s.match(n.Parent, i-1)
+	}
+
+	for p := n.Parent; p != nil; p = p.Parent {
+		if s.match(p, i-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Selector is a compiled css selector. Type, class, id and attribute
+// selectors are supported, joined by the descendant and child combinators
+// and grouped with commas.
+type Selector struct {
+	src    string
+	groups []*complexSelector
+}
+
+// Compile parses a css selector
+func Compile(sel string) (*Selector, error) {
+	p := &parser{src: sel}
+
+	s := &Selector{src: sel}
+	for {
+		group, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+
+		s.groups = append(s.groups, group)
+
+		p.skipSpace()
+		if p.pos == len(p.src) {
+			return s, nil
+		} else if p.src[p.pos] != ',' {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+		p.pos++
+	}
+}
+
+// MustCompile is like Compile but panics if the selector can't be parsed
+func MustCompile(sel string) *Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+func (s *Selector) String() string {
+	return s.src
+}
+
+// Match reports whether the node is an element matched by the selector
+func (s *Selector) Match(n *html.Node) bool {
+	for _, group := range s.groups {
+		if group.match(n, len(group.parts)-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindAll returns every descendant of root matched by the selector, in
+// document order
+func (s *Selector) FindAll(root *html.Node) []*html.Node {
+	var found []*html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if s.Match(c) {
+				found = append(found, c)
+			}
+
+			walk(c)
+		}
+	}
+
+	walk(root)
+
+	return found
+}
+
+// Find returns the first descendant of root matched by the selector, or nil
+func (s *Selector) Find(root *html.Node) *html.Node {
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if s.Match(c) {
+			return c
+		}
+
+		if found := s.Find(c); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{p.src, p.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n\f", p.src[p.pos]) != -1 {
+		p.pos++
+	}
+
+	return p.pos > start
+}
+
+func isNameByte(b byte) bool {
+	return b == '-' || b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+func (p *parser) parseName() (string, error) {
+	start := p.pos
+	for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+		p.pos++
+	}
+
+	if p.pos == start {
+		if p.pos == len(p.src) {
+			return "", p.errorf("expected a name")
+		}
+		return "", p.errorf("expected a name, got %q", p.src[p.pos])
+	}
+
+	return p.src[start:p.pos], nil
+}
+
+func (p *parser) parseComplex() (*complexSelector, error) {
+	s := &complexSelector{}
+
+	p.skipSpace()
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+
+		s.parts = append(s.parts, c)
+
+		space := p.skipSpace()
+		if p.pos == len(p.src) || p.src[p.pos] == ',' {
+			return s, nil
+		}
+
+		if p.src[p.pos] == '>' {
+			p.pos++
+			p.skipSpace()
+			s.combinators = append(s.combinators, '>')
+		} else if space {
+			s.combinators = append(s.combinators, ' ')
+		} else {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+	}
+}
+
+func (p *parser) parseCompound() (*compound, error) {
+	c := &compound{}
+
+	start := p.pos
+	if p.pos < len(p.src) && p.src[p.pos] == '*' {
+		p.pos++
+	} else if p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+		c.tag, _ = p.parseName()
+		c.tag = strings.ToLower(c.tag)
+	}
+
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '.':
+			p.pos++
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			c.attrs = append(c.attrs, attrMatcher{"class", "~=", name})
+		case '#':
+			p.pos++
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			c.attrs = append(c.attrs, attrMatcher{"id", "=", name})
+		case '[':
+			p.pos++
+			attr, err := p.parseAttr()
+			if err != nil {
+				return nil, err
+			}
+			c.attrs = append(c.attrs, attr)
+		default:
+			if p.pos == start {
+				return nil, p.errorf("unexpected %q", p.src[p.pos])
+			}
+			return c, nil
+		}
+	}
+
+	if p.pos == start {
+		return nil, p.errorf("expected a selector")
+	}
+
+	return c, nil
+}
+
+func (p *parser) parseAttr() (attrMatcher, error) {
+	p.skipSpace()
+	key, err := p.parseName()
+	if err != nil {
+		return attrMatcher{}, err
+	}
+
+	m := attrMatcher{key: strings.ToLower(key)}
+
+	p.skipSpace()
+	for _, op := range []string{"=", "~=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.src[p.pos:], op) {
+			m.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+
+	if m.op != "" {
+		p.skipSpace()
+		if m.val, err = p.parseValue(); err != nil {
+			return attrMatcher{}, err
+		}
+		p.skipSpace()
+	}
+
+	if p.pos == len(p.src) || p.src[p.pos] != ']' {
+		return attrMatcher{}, p.errorf("unclosed '['")
+	}
+	p.pos++
+
+	return m, nil
+}
+
+func (p *parser) parseValue() (string, error) {
+	if p.pos == len(p.src) {
+		return "", p.errorf("expected a value")
+	}
+
+	quote := p.src[p.pos]
+	if quote != '"' && quote != '\'' {
+		return p.parseName()
+	}
+
+	end := strings.IndexByte(p.src[p.pos+1:], quote)
+	if end == -1 {
+		return "", p.errorf("unterminated string")
+	}
+
+	val := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+
+	return val, nil
+}
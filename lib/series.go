@@ -1,10 +1,12 @@
 package funimation
 
 import (
-	"net/http"
 	"fmt"
+	"sync"
 )
 
+// Series is safe for concurrent use. Its listings are fetched on first use
+// and kept, so that every caller gets the same episodes.
 type Series struct {
 	showId      int
 
@@ -13,8 +15,12 @@ type Series struct {
 	posterUrl   string
 
 	slug        string
+	client      *Client
+
+	// mu guards the listings
+	mu          sync.RWMutex
 	episodes    EpisodeList
-	client      *http.Client
+	assets      map[AssetKind]AssetList
 }
 
 func (s *Series) ShowId() (int) {
@@ -33,13 +39,35 @@ func (s *Series) PosterUrl() (string) {
 	return s.name
 }
 
+// cachedEpisodes returns the listed episodes, or nil if the show hasn't been
+// listed yet
+func (s *Series) cachedEpisodes() (EpisodeList) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.episodes
+}
+
+// setEpisodes keeps the listed episodes, unless another caller listed them
+// first, and returns the ones that are kept
+func (s *Series) setEpisodes(eps EpisodeList) (EpisodeList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.episodes == nil {
+		s.episodes = eps
+	}
+
+	return s.episodes
+}
+
 func (s *Series) GetEpisode(ep int) (*Episode, error) {
-	if s.episodes != nil {
-		if len(s.episodes) < ep{
+	if episodes := s.cachedEpisodes(); episodes != nil {
+		if len(episodes) < ep{
 			return nil, NotFound
 		}
 
-		episode := s.episodes[ep - 1]
+		episode := episodes[ep - 1]
 		return episode, nil
 	}
 
@@ -70,8 +98,8 @@ func (s *Series) GetEpisodeBySlug(episodeSlug string) (*Episode, error) {
 }
 
 func (s *Series) GetEpisodesRange(start, end int) (EpisodeList, error) {
-	if s.episodes != nil {
-		return s.episodes, nil
+	if episodes := s.cachedEpisodes(); episodes != nil {
+		return episodes, nil
 	}
 
 	eps, err := searchForEpisodes(s.client, s.showId, end - start + 1, start - 1)
@@ -79,14 +107,12 @@ func (s *Series) GetEpisodesRange(start, end int) (EpisodeList, error) {
 		return nil, err
 	}
 
-	s.episodes = EpisodeList(eps)
-
-	return s.episodes, nil
+	return s.setEpisodes(EpisodeList(eps)), nil
 }
 
 func (s *Series) GetAllEpisodes() (EpisodeList, error) {
-	if s.episodes != nil {
-		return s.episodes, nil
+	if episodes := s.cachedEpisodes(); episodes != nil {
+		return episodes, nil
 	}
 
 	eps, err := searchForEpisodes(s.client, s.showId, int(^uint32(0) >> 1), 0)
@@ -94,7 +120,76 @@ func (s *Series) GetAllEpisodes() (EpisodeList, error) {
 		return nil, err
 	}
 
-	s.episodes = EpisodeList(eps)
+	return s.setEpisodes(EpisodeList(eps)), nil
+}
+
+// GetAssets lists every video of the given kind. Listings other than
+// episodes are typed by their section when the videos don't say otherwise.
+func (s *Series) GetAssets(kind AssetKind) (AssetList, error) {
+	s.mu.RLock()
+	assets, ok := s.assets[kind]
+	s.mu.RUnlock()
+
+	if ok {
+		return assets, nil
+	}
+
+	var eps []*Episode
+	var err error
+	if kind == EpisodeAsset {
+		eps, err = s.GetAllEpisodes()
+	} else {
+		eps, err = searchSection(s.client, kind.section(), s.showId, int(^uint32(0) >> 1), 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	assets = make(AssetList, 0, len(eps))
+	for _, ep := range eps {
+		// the episodes of other sections are not shared yet, so their
+		// videos may still be changed
+		asset := ep.Video()
+		if asset == nil {
+			// decoded without its videos
+			continue
+		}
+
+		if kind != EpisodeAsset && asset.kind == EpisodeAsset {
+			asset.kind = kind
+		}
+
+		assets = append(assets, asset)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.assets[kind]; ok {
+		return cached, nil
+	}
+
+	if s.assets == nil {
+		s.assets = make(map[AssetKind]AssetList)
+	}
+
+	s.assets[kind] = assets
+
+	return assets, nil
+}
+
+func (s *Series) GetTrailers() (AssetList, error) {
+	return s.GetAssets(TrailerAsset)
+}
+
+func (s *Series) GetClips() (AssetList, error) {
+	return s.GetAssets(ClipAsset)
+}
+
+func (s *Series) GetExtras() (AssetList, error) {
+	return s.GetAssets(ExtraAsset)
+}
 
-	return s.episodes, nil
+func (s *Series) GetMovies() (AssetList, error) {
+	return s.GetAssets(MovieAsset)
 }
\ No newline at end of file
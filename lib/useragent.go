@@ -0,0 +1,159 @@
+package funimation
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// UserAgentStrategy picks the User-Agent header of each request a client
+// makes. It must be safe for concurrent use.
+type UserAgentStrategy interface {
+	UserAgent() string
+}
+
+// FixedUserAgent sends the same user agent with every request
+type FixedUserAgent string
+
+func (ua FixedUserAgent) UserAgent() string {
+	return string(ua)
+}
+
+// RotatingUserAgents sends each user agent of a list in turn
+type RotatingUserAgents struct {
+	mu     sync.Mutex
+	agents []string
+	next   int
+}
+
+func NewRotatingUserAgents(agents ...string) *RotatingUserAgents {
+	return &RotatingUserAgents{
+		agents: agents,
+	}
+}
+
+func (r *RotatingUserAgents) UserAgent() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.agents) == 0 {
+		return ""
+	}
+
+	ua := r.agents[r.next]
+	r.next = (r.next + 1) % len(r.agents)
+
+	return ua
+}
+
+// androidDevices are phones that shipped with or were updated to the given
+// versions of android, so that a generated user agent is one that exists
+var androidDevices = []struct {
+	model    string
+	versions []int
+}{
+	{"Pixel 6", []int{12, 13, 14}},
+	{"Pixel 7", []int{13, 14}},
+	{"Pixel 8", []int{14}},
+	{"SM-G991B", []int{11, 12, 13, 14}},
+	{"SM-S911B", []int{13, 14}},
+	{"SM-A536B", []int{12, 13, 14}},
+	{"moto g power (2022)", []int{11, 12}},
+	{"M2101K6G", []int{11, 12, 13}},
+}
+
+// chromeBuilds are the major and build numbers of stable chrome releases
+var chromeBuilds = []struct {
+	major, build int
+}{
+	{110, 5481},
+	{112, 5615},
+	{114, 5735},
+	{116, 5845},
+	{118, 5993},
+	{120, 6099},
+	{122, 6261},
+	{124, 6367},
+}
+
+// RealisticUserAgent sends the user agent of chrome on a real android
+// phone, chosen at random when it is made. Like a browser, it keeps sending
+// the same one until Regenerate is called.
+type RealisticUserAgent struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+	ua  string
+}
+
+// NewRealisticUserAgent chooses its user agent with rnd, or with the global
+// random source if rnd is nil
+func NewRealisticUserAgent(rnd *rand.Rand) *RealisticUserAgent {
+	r := &RealisticUserAgent{
+		rnd: rnd,
+	}
+	r.Regenerate()
+
+	return r
+}
+
+func (r *RealisticUserAgent) intn(n int) int {
+	if r.rnd == nil {
+		return rand.Intn(n)
+	}
+
+	return r.rnd.Intn(n)
+}
+
+// Regenerate chooses another user agent
+func (r *RealisticUserAgent) Regenerate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	device := androidDevices[r.intn(len(androidDevices))]
+	chrome := chromeBuilds[r.intn(len(chromeBuilds))]
+
+	r.ua = fmt.Sprintf("Mozilla/5.0 (Linux; Android %d; %s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.%d Mobile Safari/537.36",
+		device.versions[r.intn(len(device.versions))],
+		device.model,
+		chrome.major,
+		chrome.build,
+		50 + r.intn(150))
+}
+
+func (r *RealisticUserAgent) UserAgent() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ua
+}
+
+// SetUserAgent sets how the client picks the user agent of its requests. A
+// nil strategy sends go's default user agent.
+func (f *Client) SetUserAgent(strategy UserAgentStrategy) {
+	f.userAgent = strategy
+}
+
+func (f *Client) setUserAgent(req *http.Request) {
+	if f.userAgent == nil {
+		return
+	}
+
+	if ua := f.userAgent.UserAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+}
+
+// userAgentTransport sets the user agent of requests made outside of the
+// client, like video downloads
+type userAgentTransport struct {
+	client *Client
+	rt     http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	t.client.setUserAgent(req)
+
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,107 @@
+package funimation
+
+import (
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+// uaRecorder keeps the user agent of every request it sends
+type uaRecorder struct {
+	mu     sync.Mutex
+	agents []string
+	rt     http.RoundTripper
+}
+
+func (r *uaRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.agents = append(r.agents, req.Header.Get("User-Agent"))
+	r.mu.Unlock()
+
+	return r.rt.RoundTrip(req)
+}
+
+func TestUserAgentOnEveryRequest(t *testing.T) {
+	srv := funimationtest.NewDefaultServer()
+	t.Cleanup(srv.Close)
+
+	httpClient := srv.Client()
+	recorder := &uaRecorder{rt: httpClient.Transport}
+	httpClient.Transport = recorder
+
+	client := NewWithHttpClient(httpClient)
+	client.SetUserAgent(FixedUserAgent("test-agent/1.0"))
+
+	if err := client.Login("nobody@example.com", "wrong"); err == nil {
+		t.Fatal("expected the login to fail")
+	}
+
+	series, err := client.GetSeries("multi-season")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := series.GetAllEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := episodes[0].GetVideoUrl(Subbed, StandardDefinition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	media := client.MediaHttpClient()
+	media.Transport.(*userAgentTransport).rt = recorder
+	res, err := media.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if len(recorder.agents) < 4 {
+		t.Fatalf("only made %d requests", len(recorder.agents))
+	}
+
+	for i, ua := range recorder.agents {
+		if ua != "test-agent/1.0" {
+			t.Errorf("request %d: got user agent %q", i, ua)
+		}
+	}
+}
+
+func TestRotatingUserAgents(t *testing.T) {
+	r := NewRotatingUserAgents("a", "b", "c")
+
+	for i, want := range []string{"a", "b", "c", "a"} {
+		if got := r.UserAgent(); got != want {
+			t.Errorf("%d: got %q, want %q", i, got, want)
+		}
+	}
+
+	if got := NewRotatingUserAgents().UserAgent(); got != "" {
+		t.Errorf("got %q from an empty list", got)
+	}
+}
+
+var realisticUA = regexp.MustCompile(`^Mozilla/5\.0 \(Linux; Android 1[1-4]; [^;]+\) AppleWebKit/537\.36 \(KHTML, like Gecko\) Chrome/1[12]\d\.0\.\d{4}\.\d+ Mobile Safari/537\.36$`)
+
+func TestRealisticUserAgent(t *testing.T) {
+	r := NewRealisticUserAgent(rand.New(rand.NewSource(1)))
+
+	ua := r.UserAgent()
+	if r.UserAgent() != ua {
+		t.Error("the user agent changed without being regenerated")
+	}
+
+	for i := 0; i < 100; i++ {
+		if ua := r.UserAgent(); !realisticUA.MatchString(ua) {
+			t.Errorf("unrealistic user agent %q", ua)
+		}
+
+		r.Regenerate()
+	}
+}
@@ -1,26 +1,24 @@
 package funimation
 
 import (
-	"net/http"
 	"bytes"
 	"io"
 	"encoding/json"
+	"errors"
+	"golang.ssttevee.com/funimation/lib/redact"
 	"fmt"
-	"strings"
-	"golang.org/x/net/html"
-	"sync"
+	"strconv"
 )
 
-var collectCookies sync.Once
-
-func getJsonObject(client *http.Client, url string) (map[string]interface{}, error) {
-	res, err := client.Get(url)
+func getJsonObject(client *Client, url string) (map[string]interface{}, error) {
+	res, err := client.get(url)
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != 200 {
-		return nil, NotFound
+		return nil, &StatusError{res.StatusCode, redact.Url(url)}
 	}
 
 	buf := &bytes.Buffer{}
@@ -34,79 +32,68 @@ func getJsonObject(client *http.Client, url string) (map[string]interface{}, err
 	return ajax, nil
 }
 
-func searchForEpisodes(client *http.Client, showId, limit, offset int) ([]*Episode, error) {
+func searchForEpisodes(client *Client, showId, limit, offset int) ([]*Episode, error) {
+	return searchSection(client, "episodes", showId, limit, offset)
+}
+
+func listingUrl(section string, showId, limit, offset int) string {
+	return fmt.Sprintf("http://www.funimation.com/shows/viewAllFiltered?section=%s&limit=%d&offset=%d&showid=%d", section, limit, offset, showId)
+}
+
+// searchSection lists the videos in a section of a show's listing, like
+// episodes, trailers or movies
+func searchSection(client *Client, section string, showId, limit, offset int) ([]*Episode, error) {
 	// collect cookies for the first time
-	collectCookies.Do(func() {
-		client.Get("http://www.funimation.com/videos/episodes")
+	client.collectCookies.Do(func() {
+		if res, err := client.get("http://www.funimation.com/videos/episodes"); err == nil {
+			res.Body.Close()
+		}
 	})
 
-	var episodes []*Episode
+	ajax, err := getJsonObject(client, listingUrl(section, showId, limit, offset))
+	if err != nil {
+		return nil, err
+	}
+
+	main, ok := ajax["main"].(string)
+	if !ok {
+		return nil, errors.New("listing: no html in response")
+	}
 
-	searchUrl := fmt.Sprintf("http://www.funimation.com/shows/viewAllFiltered?section=episodes&limit=%d&offset=%d&showid=%d", limit, offset, showId)
-	ajax, err := getJsonObject(client, searchUrl)
+	cards, err := extractCards(main)
 	if err != nil {
 		return nil, err
 	}
 
-	tokenizer := html.NewTokenizer(strings.NewReader(ajax["main"].(string)))
-
-	errChan := make(chan error)
-
-	var lookForEpisodeType bool
-	var prevEpisode *Episode
-	for {
-		tokenType := tokenizer.Next()
-
-		if tokenType == html.ErrorToken {
-			break
-		} else if tokenType == html.StartTagToken {
-			token := tokenizer.Token()
-
-			if token.Data == "a" {
-				href := ""
-				foundWatchLink := false
-				for _, attr := range token.Attr {
-					if attr.Key == "class" {
-						if strings.Contains(attr.Val, "watchLinks") {
-							foundWatchLink = true
-							lookForEpisodeType = true
-						}
-					} else if attr.Key == "href" {
-						href = attr.Val
-					}
-				}
-
-				if foundWatchLink {
-					ep := &Episode{
-						client: client,
-						url: href,
-						episodeType: Regular}
-
-					episodes = append(episodes, ep)
-
-					go func() {
-						errChan<- ep.collectData()
-					}()
-
-					prevEpisode = ep
-				}
-			}
-		} else if lookForEpisodeType {
-			token := tokenizer.Token()
-
-			if tokenType == html.EndTagToken && token.Data == "a" {
-				lookForEpisodeType = false;
-			} else if tokenType == html.TextToken {
-				text := strings.ToLower(token.Data)
-				if strings.Contains(text, "episode") {
-					lookForEpisodeType = false;
-				} else if strings.Contains(text, "ova") {
-					prevEpisode.episodeType = Ova
-				} else if strings.Contains(text, "special") {
-					prevEpisode.episodeType = Special
-				}
-			}
+	var episodes []*Episode
+
+	// every episode has room for its result, so that none of them is left
+	// waiting when the first error is returned
+	errChan := make(chan error, len(cards))
+
+	for _, card := range cards {
+		if card.Get("url") == "" {
+			continue
 		}
+
+		ep := &Episode{
+			client: client,
+			url: card.Get("url"),
+			title: card.Get("title"),
+			thumbnailUrl: card.Get("thumbnail"),
+			badges: card["badges"],
+			episodeType: parseEpisodeType(card.Get("type"), "")}
+
+		if num, err := strconv.ParseFloat(card.Get("number"), 32); err == nil {
+			ep.episodeNum = float32(num)
+		}
+
+		episodes = append(episodes, ep)
+
+		// the rest is taken from the episode's page
+		go func() {
+			errChan<- ep.collectData()
+		}()
 	}
 
 	for i := 0; i < len(episodes); i++ {
@@ -115,5 +102,7 @@ func searchForEpisodes(client *http.Client, showId, limit, offset int) ([]*Episo
 		}
 	}
 
+	client.log().Debug("listed show", "show", showId, "section", section, "cards", len(cards), "episodes", len(episodes))
+
 	return episodes, nil
-}
+}
\ No newline at end of file
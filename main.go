@@ -1,10 +1,13 @@
 package main // import "golang.ssttevee.com/funimation"
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.ssttevee.com/funimation/lib"
+	"net/http"
 	"net/http/cookiejar"
-	"log"
+	"log/slog"
 	"io"
 	"os"
 	"time"
@@ -12,7 +15,11 @@ import (
 	"flag"
 	"strings"
 	"strconv"
-	"github.com/ssttevee/go-downloader"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"golang.ssttevee.com/funimation/lib/download"
+	"golang.ssttevee.com/funimation/lib/progress"
 )
 
 type writerMiddleware struct {
@@ -28,26 +35,189 @@ func (w *writerMiddleware) Write(p []byte) (int, error) {
 
 var funimationClient *funimation.Client
 
-func init() {
-	downloader.TempDir = os.TempDir() + "/.funimation"
+// tempDir is where partial downloads are kept
+var tempDir = filepath.Join(os.TempDir(), ".funimation")
+
+// logger writes to stderr, leaving stdout for what was asked for
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 
+func init() {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal(err.Error())
 		return
 	}
 
 	funimationClient = funimation.New(jar)
 }
 
-func main() {
+func fatal(msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+func addLogFlags(cmd *flag.FlagSet) {
+	cmd.Bool("v", false, "verbose; log every request made")
+	cmd.Bool("q", false, "quiet; only log errors")
+	cmd.String("log-format", "text", "format of the log on stderr, `text or json`")
+}
+
+func addRequestFlags(cmd *flag.FlagSet) {
+	cmd.Float64("request-rate", funimation.DefaultRequestRate, "maximum `requests` per second to the website, or 0 for no limit")
+	cmd.Int("request-burst", funimation.DefaultRequestBurst, "number of `requests` that may be made at once before -request-rate applies")
+	cmd.String("proxy", "", "`url` of an http or socks5 proxy, i.e. socks5://127.0.0.1:1080 (default $FUNIMATION_PROXY)")
+	cmd.String("proxy-route", "", "which requests go through -proxy, `all, metadata or media` (default $FUNIMATION_PROXY_ROUTE or all)")
+	cmd.String("user-agent", "", "send this `user agent` with every request instead of one of a real phone")
+	cmd.String("user-agents", "", "send each user agent in this `file`, one per line, in turn")
+}
+
+// config is read from funimation/config.json in the user's config directory.
+// Flags and environment variables take precedence over it.
+type config struct {
+	Proxy      string `json:"proxy"`
+	ProxyRoute string `json:"proxyRoute"`
+}
+
+func loadConfig() (*config, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		// nowhere to look, so there is no config
+		return &config{}, nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "funimation", "config.json"))
+	if os.IsNotExist(err) {
+		return &config{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+
+	return &c, nil
+}
+
+// proxySettings picks the proxy and its route from the flags, then from the
+// environment, then from the config file
+func proxySettings(cmd *flag.FlagSet) (proxy string, route string, err error) {
+	c, err := loadConfig()
+	if err != nil {
+		return "", "", err
+	}
+
+	pick := func(flagName, envName, configValue string) string {
+		if v := cmd.Lookup(flagName).Value.String(); v != "" {
+			return v
+		} else if v := os.Getenv(envName); v != "" {
+			return v
+		}
+
+		return configValue
+	}
+
+	proxy = pick("proxy", "FUNIMATION_PROXY", c.Proxy)
+	route = pick("proxy-route", "FUNIMATION_PROXY_ROUTE", c.ProxyRoute)
+	if route == "" {
+		route = string(funimation.AllRequests)
+	}
+
+	return proxy, route, nil
+}
+
+// setupClient configures the funimation client from the request flags
+func setupClient(cmd *flag.FlagSet) {
+	funimationClient.SetRequestRate(cmd.Lookup("request-rate").Value.(flag.Getter).Get().(float64), cmd.Lookup("request-burst").Value.(flag.Getter).Get().(int))
+
+	if file := cmd.Lookup("user-agents").Value.String(); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			fatal("failed to read user agents", "error", err)
+		}
+
+		var agents []string
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				agents = append(agents, line)
+			}
+		}
+
+		if len(agents) == 0 {
+			fatal("no user agents in file", "file", file)
+		}
+
+		funimationClient.SetUserAgent(funimation.NewRotatingUserAgents(agents...))
+	} else if ua := cmd.Lookup("user-agent").Value.String(); ua != "" {
+		funimationClient.SetUserAgent(funimation.FixedUserAgent(ua))
+	}
+
+	proxy, route, err := proxySettings(cmd)
+	if err != nil {
+		fatal("failed to read config", "error", err)
+	} else if proxy == "" {
+		return
+	}
+
+	proxyUrl, err := funimation.ParseProxyUrl(proxy)
+	if err != nil {
+		fatal("bad `proxy` setting", "error", err)
+	}
+
+	proxyRoute, err := funimation.ParseProxyRoute(route)
+	if err != nil {
+		fatal("bad `proxy-route` setting", "error", err)
+	}
+
+	if err := funimationClient.SetProxy(proxyUrl, proxyRoute); err != nil {
+		fatal("failed to set proxy", "error", err)
+	}
+
+	logger.Debug("using proxy", "proxy", proxyUrl.Redacted(), "route", proxyRoute)
+}
+
+// setupLogging makes the logger of the cli and of the funimation client
+// from the log flags
+func setupLogging(cmd *flag.FlagSet) {
+	level := slog.LevelInfo
+	if cmd.Lookup("v").Value.(flag.Getter).Get().(bool) {
+		level = slog.LevelDebug
+	} else if cmd.Lookup("q").Value.(flag.Getter).Get().(bool) {
+		level = slog.LevelError
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format := cmd.Lookup("log-format").Value.(flag.Getter).Get().(string); format {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, opts))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	default:
+		fatal("unknown log format", "format", format)
+	}
+
+	funimationClient.SetLogger(logger)
+}
+
+func newListCmd() *flag.FlagSet {
 	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
 	listCmd.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: funimation list <show>")
-		fmt.Fprintln(os.Stderr, "    OR funimation list <show-url>\n")
-		fmt.Fprintln(os.Stderr, "Lists all episodes in the given show\n\n")
+		fmt.Fprint(os.Stderr, "    OR funimation list <show-url>\n\n")
+		fmt.Fprint(os.Stderr, "Lists all episodes in the given show\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+		listCmd.PrintDefaults()
 	}
+	listCmd.String("kind", "episode", "comma separated kinds of videos to list, `episode, trailer, clip, extra or movie`")
+	addLogFlags(listCmd)
+	addRequestFlags(listCmd)
+
+	return listCmd
+}
 
+func newDownloadCmd() *flag.FlagSet {
 	downloadCmd := flag.NewFlagSet("download", flag.ExitOnError)
 	downloadCmd.String("email", "", "your funimation account email address")
 	downloadCmd.String("password", "", "your funimation account password")
@@ -55,22 +225,103 @@ func main() {
 	downloadCmd.String("language", funimation.Subbed, "either `sub or dub`")
 	downloadCmd.Bool("url-only", false, "get the url instead of downloading")
 	downloadCmd.Int("threads", 1, "number of threads for multithreaded download")
+	downloadCmd.Int("jobs", 3, "number of episodes to download at the same time")
+	downloadCmd.Int("retries", 3, "number of times to retry a failed download")
+	downloadCmd.Bool("verify", true, "check that downloaded files are complete, and retry them if not")
+	downloadCmd.String("limit-rate", "", "limit the combined download speed, i.e. `2M` for 2 megabytes per second")
+	downloadCmd.String("full-speed", "", "comma separated `HH:MM-HH:MM` windows during which -limit-rate is lifted")
+	downloadCmd.String("progress", "auto", "how to show download progress, `auto, bars, lines or json`")
 	downloadCmd.Bool("guess", false, "guess urls for non-public videos")
+	downloadCmd.String("kind", "episode", "comma separated kinds of videos to download, `episode, trailer, clip, extra or movie`; episode numbers count within each kind")
+	addLogFlags(downloadCmd)
+	addRequestFlags(downloadCmd)
 	downloadCmd.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: funimation download [options] <show> <episode> [<episode>...]")
 		fmt.Fprintln(os.Stderr, "    OR funimation download [options] <show> <episode-nums> [<episode-nums>...]")
 		fmt.Fprintln(os.Stderr, "    OR funimation download [options] <show-id> <episode-nums> [<episode-nums>...]")
-		fmt.Fprintln(os.Stderr, "    OR funimation download [options] <episode-url> [<episode-url>...]\n")
-		fmt.Fprintln(os.Stderr, "Downloads an episode from the given show\n")
+		fmt.Fprint(os.Stderr, "    OR funimation download [options] <episode-url> [<episode-url>...]\n\n")
+		fmt.Fprint(os.Stderr, "Downloads an episode from the given show\n\n")
 		fmt.Fprintln(os.Stderr, "Options:")
 		downloadCmd.PrintDefaults()
 	}
 
+	return downloadCmd
+}
+
+func newDoctorCmd() *flag.FlagSet {
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	doctorCmd.String("email", "", "your funimation account email address")
+	doctorCmd.String("password", "", "your funimation account password")
+	doctorCmd.String("bundle", "", "write a zip `file` with the report and every response, with tokens and user ids removed")
+	addLogFlags(doctorCmd)
+	addRequestFlags(doctorCmd)
+	doctorCmd.Usage = func() {
+		fmt.Fprint(os.Stderr, "Usage: funimation doctor [options] [<show>]\n\n")
+		fmt.Fprintf(os.Stderr, "Checks each step of getting a video from the website against a show (default %q)\n\n", doctorShow)
+		fmt.Fprintln(os.Stderr, "Options:")
+		doctorCmd.PrintDefaults()
+	}
+
+	return doctorCmd
+}
+
+func newGuessCmd() *flag.FlagSet {
+	guessCmd := flag.NewFlagSet("guess", flag.ExitOnError)
+	guessCmd.String("email", "", "your funimation account email address")
+	guessCmd.String("password", "", "your funimation account password")
+	guessCmd.String("quality", "all", "quality of the video, `sd, hd, fhd or all`")
+	guessCmd.String("language", funimation.Subbed, "either `sub or dub`")
+	guessCmd.Bool("all", false, "also show the guesses that were not found")
+	addLogFlags(guessCmd)
+	addRequestFlags(guessCmd)
+	guessCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: funimation guess [options] <show> <episode>")
+		fmt.Fprint(os.Stderr, "    OR funimation guess [options] <episode-url>\n\n")
+		fmt.Fprint(os.Stderr, "Guesses the urls of an episode's videos on the cdn, and checks which of them exist\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+		guessCmd.PrintDefaults()
+	}
+
+	return guessCmd
+}
+
+func newProbeCmd() *flag.FlagSet {
+	probeCmd := flag.NewFlagSet("probe", flag.ExitOnError)
+	probeCmd.String("email", "", "your funimation account email address")
+	probeCmd.String("password", "", "your funimation account password")
+	probeCmd.String("kind", "episode", "comma separated kinds of videos to probe, `episode, trailer, clip, extra or movie`; episode numbers count within each kind")
+	addLogFlags(probeCmd)
+	addRequestFlags(probeCmd)
+	probeCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: funimation probe [options] <show> <episode> [<episode>...]")
+		fmt.Fprintln(os.Stderr, "    OR funimation probe [options] <show> <episode-nums> [<episode-nums>...]")
+		fmt.Fprint(os.Stderr, "    OR funimation probe [options] <episode-url> [<episode-url>...]\n\n")
+		fmt.Fprint(os.Stderr, "Checks the video url of every language and quality of the given episodes\n\n")
+		fmt.Fprintln(os.Stderr, "Options:")
+		probeCmd.PrintDefaults()
+	}
+
+	return probeCmd
+}
+
+// doctorShow is a show that is known to work
+const doctorShow = "steins-gate"
+
+func main() {
+	listCmd := newListCmd()
+	downloadCmd := newDownloadCmd()
+	doctorCmd := newDoctorCmd()
+	guessCmd := newGuessCmd()
+	probeCmd := newProbeCmd()
+
 	if len(os.Args) == 1 {
-		fmt.Println("Usage: funimation <command> [<args>]\n")
+		fmt.Print("Usage: funimation <command> [<args>]\n\n")
 		fmt.Println("Available commands are: ")
 		fmt.Println("  list      Lists all episodes in the given series")
 		fmt.Println("  download  Downloads an episode from the given series")
+		fmt.Println("  doctor    Finds out what changed when the website breaks")
+		fmt.Println("  guess     Finds the urls of an episode's videos on the cdn")
+		fmt.Println("  probe     Checks which languages and qualities of an episode can be downloaded")
 		return
 	}
 
@@ -81,11 +332,27 @@ func main() {
 	case "download":
 		downloadCmd.Parse(os.Args[2:])
 		break
+	case "doctor":
+		doctorCmd.Parse(os.Args[2:])
+		break
+	case "guess":
+		guessCmd.Parse(os.Args[2:])
+		break
+	case "probe":
+		probeCmd.Parse(os.Args[2:])
+		break
 	default:
 		fmt.Printf("%q is not valid command.\n", os.Args[1])
 		os.Exit(2)
 	}
 
+	for _, cmd := range []*flag.FlagSet{listCmd, downloadCmd, doctorCmd, guessCmd, probeCmd} {
+		if cmd.Parsed() {
+			setupLogging(cmd)
+			setupClient(cmd)
+		}
+	}
+
 	switch {
 	case listCmd.Parsed():
 		show := listCmd.Arg(0)
@@ -93,30 +360,144 @@ func main() {
 			listCmd.Usage()
 			os.Exit(2)
 		}
-		doList(show)
+		doList(show, parseKinds(listCmd))
 	case downloadCmd.Parsed():
 		doDownload(downloadCmd)
+	case doctorCmd.Parsed():
+		if !doDoctor(doctorCmd) {
+			os.Exit(1)
+		}
+	case guessCmd.Parsed():
+		if !doGuess(guessCmd) {
+			os.Exit(1)
+		}
+	case probeCmd.Parsed():
+		if !doProbe(probeCmd) {
+			os.Exit(1)
+		}
 	}
 }
 
-func doList(show string) {
-	series, err := funimationClient.GetSeries(show)
-	if err != nil {
-		log.Fatal("Failed to get series: ", err)
+// doDoctor reports whether every stage passed
+func doDoctor(cmd *flag.FlagSet) bool {
+	show := cmd.Arg(0)
+	if show == "" {
+		show = doctorShow
+	}
+
+	if email := cmd.Lookup("email").Value.(flag.Getter).Get().(string); email != "" {
+		if err := funimationClient.Login(email, cmd.Lookup("password").Value.(flag.Getter).Get().(string)); err != nil {
+			fatal("login failed", "error", err)
+		}
+	}
+
+	diagnosis := funimationClient.Diagnose(show)
+	fmt.Print(diagnosis.String())
+
+	if bundle := cmd.Lookup("bundle").Value.(flag.Getter).Get().(string); bundle != "" {
+		f, err := os.Create(bundle)
+		if err != nil {
+			fatal("failed to create bundle", "error", err)
+		}
+
+		if err := diagnosis.WriteBundle(f); err != nil {
+			fatal("failed to write bundle", "error", err)
+		}
+
+		if err := f.Close(); err != nil {
+			fatal("failed to write bundle", "error", err)
+		}
+
+		fmt.Printf("\nWrote %s\n", bundle)
+	}
+
+	return diagnosis.Failed() == nil
+}
+
+// doGuess reports whether any guess was found
+func doGuess(cmd *flag.FlagSet) bool {
+	show := cmd.Arg(0)
+	if show == "" || !strings.HasPrefix(show, "http") && cmd.Arg(1) == "" {
+		cmd.Usage()
+		os.Exit(2)
 	}
 
-	episodes, err := series.GetAllEpisodes()
+	if email := cmd.Lookup("email").Value.(flag.Getter).Get().(string); email != "" {
+		if err := funimationClient.Login(email, cmd.Lookup("password").Value.(flag.Getter).Get().(string)); err != nil {
+			fatal("login failed", "error", err)
+		}
+	}
+
+	var episode *funimation.Episode
+	var err error
+	if strings.HasPrefix(show, "http") {
+		episode, err = funimationClient.GetEpisodeFromUrl(show)
+	} else {
+		var series *funimation.Series
+		if showNum, numErr := strconv.ParseInt(show, 10, 32); numErr == nil {
+			series, err = funimationClient.GetSeriesById(int(showNum))
+		} else {
+			series, err = funimationClient.GetSeries(show)
+		}
+		if err != nil {
+			fatal("failed to get series", "show", show, "error", err)
+		}
+
+		if epNum, numErr := strconv.ParseInt(cmd.Arg(1), 10, 32); numErr == nil {
+			episode, err = series.GetEpisode(int(epNum))
+		} else {
+			episode, err = series.GetEpisodeBySlug(cmd.Arg(1))
+		}
+	}
 	if err != nil {
-		log.Fatal("Failed to get episodes: ", err)
+		fatal("failed to get episode", "error", err)
 	}
 
-	fmt.Println(series.Title())
-	fmt.Println(series.Description())
-	fmt.Println()
-	fmt.Print(episodes.String())
+	qualities := []funimation.EpisodeQuality{funimation.StandardDefinition, funimation.HighDefinition, funimation.FullHighDefinition}
+	if quality := cmd.Lookup("quality").Value.(flag.Getter).Get().(string); quality != "all" {
+		qualities = []funimation.EpisodeQuality{funimation.ParseEpisodeQuality(quality)}
+	}
+
+	language := funimation.EpisodeLanguage(cmd.Lookup("language").Value.(flag.Getter).Get().(string))
+	showAll := cmd.Lookup("all").Value.(flag.Getter).Get().(bool)
+
+	found := 0
+	for _, video := range episode.Assets() {
+		fmt.Printf("%s %v - %s:\n", video.Kind(), video.Number(), video.Title())
+
+		for _, quality := range qualities {
+			guesses, err := video.ProbeVideoUrls(language, quality)
+			if err != nil {
+				logger.Error("failed to guess urls", "video", video.Title(), "quality", quality.String(), "error", err)
+				continue
+			}
+
+			for _, g := range guesses {
+				if g.Exists() {
+					found++
+
+					size := "unknown size"
+					if g.Size >= 0 {
+						size = humanize.Bytes(uint64(g.Size))
+					}
+
+					fmt.Printf("\t%s\t%s\t%s\t%s\t%s\n", quality, g.Guesser, size, g.ContentType, g.Url)
+				} else if showAll && g.Err != nil {
+					fmt.Printf("\t%s\t%s\t%v\t%s\n", quality, g.Guesser, g.Err, g.Url)
+				} else if showAll {
+					fmt.Printf("\t%s\t%s\tstatus %d\t%s\n", quality, g.Guesser, g.Status, g.Url)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\nFound %d videos\n", found)
+
+	return found > 0
 }
 
-func doDownload(cmd *flag.FlagSet) {
+// doProbe reports whether any video could be downloaded
+func doProbe(cmd *flag.FlagSet) bool {
 	show := cmd.Arg(0)
 	if show == "" || !strings.HasPrefix(show, "http") && cmd.Arg(1) == "" {
 		cmd.Usage()
@@ -124,33 +505,262 @@ func doDownload(cmd *flag.FlagSet) {
 	}
 
 	if email := cmd.Lookup("email").Value.(flag.Getter).Get().(string); email != "" {
-		password := cmd.Lookup("password").Value.(flag.Getter).Get().(string)
+		if err := funimationClient.Login(email, cmd.Lookup("password").Value.(flag.Getter).Get().(string)); err != nil {
+			fatal("login failed", "error", err)
+		}
+	}
 
-		if password == "" {
-			log.Fatal("Got `email` flag but missing `password` flag")
+	targets := selectTargets(cmd)
+	if len(targets) == 0 {
+		cmd.Usage()
+		os.Exit(2)
+	}
+
+	qualities := []funimation.EpisodeQuality{funimation.StandardDefinition, funimation.HighDefinition, funimation.FullHighDefinition}
+
+	available := 0
+	for _, t := range targets {
+		fmt.Printf("%s:\n", t.name)
+
+		downloadable := false
+		cells := make(map[funimation.EpisodeLanguage]map[funimation.EpisodeQuality]string)
+		for _, av := range t.video.CheckAvailability() {
+			if av.Available() {
+				downloadable = true
+			}
+
+			if cells[av.Language] == nil {
+				cells[av.Language] = make(map[funimation.EpisodeQuality]string)
+			}
+			cells[av.Language][av.Quality] = availabilityCell(av)
 		}
 
-		if err := funimationClient.Login(email, password); err != nil {
-			log.Fatal("Login failed: ", err)
+		if downloadable {
+			available++
 		}
+
+		langs := t.video.Languages()
+		sort.Slice(langs, func(i, j int) bool { return langs[i] > langs[j] })
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		fmt.Fprint(w, "\t")
+		for _, quality := range qualities {
+			fmt.Fprintf(w, "\t%s", quality)
+		}
+		fmt.Fprintln(w)
+
+		for _, lang := range langs {
+			fmt.Fprintf(w, "\t%s", lang)
+			for _, quality := range qualities {
+				fmt.Fprintf(w, "\t%s", cells[lang][quality])
+			}
+			fmt.Fprintln(w)
+		}
+
+		w.Flush()
 	}
 
-	episodes := make([]*funimation.Episode, 0)
+	fmt.Printf("\n%d of %d videos can be downloaded\n", available, len(targets))
+
+	return available > 0
+}
+
+// availabilityCell describes what was found for one language and quality in
+// a few words
+func availabilityCell(av *funimation.Availability) string {
+	if !av.Offered {
+		return "not offered"
+	} else if av.Restriction != nil {
+		return av.Restriction.Reason
+	} else if av.Err != nil {
+		return av.Err.Error()
+	}
+
+	parts := []string{strconv.Itoa(av.Status)}
+	if av.Size >= 0 {
+		parts = append(parts, humanize.Bytes(uint64(av.Size)))
+	}
+	if !av.Expiry.IsZero() {
+		parts = append(parts, "expires "+av.Expiry.Format("15:04"))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func parseKinds(cmd *flag.FlagSet) []funimation.AssetKind {
+	var kinds []funimation.AssetKind
+	for _, k := range strings.Split(cmd.Lookup("kind").Value.(flag.Getter).Get().(string), ",") {
+		kind, err := funimation.ParseAssetKind(k)
+		if err != nil {
+			fatal("bad `kind` flag", "error", err)
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	return kinds
+}
+
+func doList(show string, kinds []funimation.AssetKind) {
+	series, err := funimationClient.GetSeries(show)
+	if err != nil {
+		fatal("failed to get series", "show", show, "error", err)
+	}
+
+	fmt.Println(series.Title())
+	fmt.Println(series.Description())
+
+	for _, kind := range kinds {
+		fmt.Println()
+
+		if kind == funimation.EpisodeAsset {
+			episodes, err := series.GetAllEpisodes()
+			if err != nil {
+				fatal("failed to get episodes", "show", show, "error", err)
+			}
+
+			fmt.Print(episodes.String())
+			continue
+		}
+
+		assets, err := series.GetAssets(kind)
+		if err != nil {
+			fatal("failed to get assets", "show", show, "kind", kind, "error", err)
+		}
+
+		fmt.Printf("%d %ss:\n", len(assets), kind)
+		fmt.Print(assets.String())
+	}
+}
+
+// tokenRejected reports whether a download failed because the cdn refused
+// its auth token
+func tokenRejected(err error) bool {
+	var status *download.StatusError
+	return errors.As(err, &status) && status.Code == http.StatusForbidden
+}
+
+// target is a video to download and what to call it
+type target struct {
+	name  string
+	file  string
+	video *funimation.Asset
+}
+
+func newTarget(episode *funimation.Episode) *target {
+	if episode.Video().Kind() != funimation.EpisodeAsset {
+		return newAssetTarget(episode.Video(), 0)
+	}
+
+	var epnum interface{}
+	if episode.EpisodeNumber() == 0 {
+		epnum = ""
+	} else {
+		epnum = episode.EpisodeNumber()
+	}
+
+	return &target{
+		name:  fmt.Sprintf("Season %d, %s %v", episode.SeasonNumber(), episode.Type(), episode.EpisodeNumber()),
+		file:  fmt.Sprintf("s%d%s%v - %s", episode.SeasonNumber(), episode.TypeCode(), epnum, episode.Title()),
+		video: episode.Video(),
+	}
+}
+
+// newAssetTarget names an asset by its kind and its position n in the
+// listing of that kind, if known
+func newAssetTarget(asset *funimation.Asset, n int) *target {
+	var num interface{} = ""
+	if n != 0 {
+		num = n
+	}
+
+	return &target{
+		name:  fmt.Sprintf("%s %v - %s", asset.Kind(), num, asset.Title()),
+		file:  fmt.Sprintf("%s%v - %s", asset.Kind(), num, asset.Title()),
+		video: asset,
+	}
+}
+
+// selectAssets picks assets by their 1-based position, a range of positions
+// or * for all of them
+func selectAssets(assets funimation.AssetList, arg string) ([]*target, error) {
+	start, end := 1, len(assets)
+	if arg != "*" {
+		startEnd := strings.Split(arg, "-")
+		if len(startEnd) > 2 {
+			return nil, fmt.Errorf("Range value `%s` must contain 1 dash character", arg)
+		}
+
+		first, err := strconv.ParseInt(startEnd[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Range value must be numeric")
+		}
+
+		last := first
+		if len(startEnd) == 2 {
+			if last, err = strconv.ParseInt(startEnd[1], 10, 32); err != nil {
+				return nil, fmt.Errorf("Range value must be numeric")
+			}
+		}
+
+		start, end = int(first), int(last)
+	}
+
+	var targets []*target
+	for n := start; n <= end; n++ {
+		if n < 1 || n > len(assets) {
+			return nil, funimation.NotFound
+		}
+
+		targets = append(targets, newAssetTarget(assets[n - 1], n))
+	}
+
+	return targets, nil
+}
+
+// selectTargets finds the videos named by the show and episode arguments, or
+// the episode url arguments, of the command, logging the ones that can't be
+// found
+func selectTargets(cmd *flag.FlagSet) []*target {
+	show := cmd.Arg(0)
+
+	kinds := parseKinds(cmd)
+	wantKind := func(kind funimation.AssetKind) bool {
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	targets := make([]*target, 0)
+
+	addEpisode := func(episode *funimation.Episode) {
+		if kind := episode.Video().Kind(); !wantKind(kind) {
+			logger.Info("skipping video of another kind", "title", episode.Title(), "kind", kind)
+			return
+		}
+
+		targets = append(targets, newTarget(episode))
+	}
 
 	if strings.HasPrefix(show, "http") {
 		for _, url := range cmd.Args() {
 			if !strings.HasPrefix(url[strings.Index(url, "://"):], "://www.funimation.com/shows/") {
-				log.Println("Only funimation show urls are allowed")
+				logger.Error("only funimation show urls are allowed", "url", url)
 				continue
 			}
 
 			episode, err := funimationClient.GetEpisodeFromUrl(url)
 			if err != nil {
-				log.Println("Failed to get episode: ", err)
+				logger.Error("failed to get episode", "url", url, "error", err)
 				continue
 			}
 
-			episodes = append(episodes, episode)
+			addEpisode(episode)
 		}
 	} else {
 		var series *funimation.Series
@@ -158,20 +768,59 @@ func doDownload(cmd *flag.FlagSet) {
 			// not a show number, assume it is a show slug
 			series, err = funimationClient.GetSeries(show)
 			if err != nil {
-				log.Fatal("Failed to get series: ", err)
+				fatal("failed to get series", "show", show, "error", err)
 			}
 		} else {
 			series, err = funimationClient.GetSeriesById(int(showNum))
 			if err != nil {
-				log.Fatal("Failed to get series: ", err)
+				fatal("failed to get series", "show", show, "error", err)
 			}
 		}
 
+		episodes := make([]*funimation.Episode, 0)
+
 		for i := 1; i < cmd.NArg(); i++ {
 			arg := cmd.Arg(i)
+
+			if _, err := strconv.ParseInt(strings.SplitN(arg, "-", 2)[0], 10, 32); err != nil && arg != "*" {
+				episode, err := series.GetEpisodeBySlug(arg)
+				if err != nil {
+					logger.Error("failed to get episode", "episode", arg, "error", err)
+					continue
+				}
+
+				addEpisode(episode)
+				continue
+			}
+
+			// numbers count within each kind of video
+			for _, kind := range kinds {
+				if kind == funimation.EpisodeAsset {
+					continue
+				}
+
+				assets, err := series.GetAssets(kind)
+				if err != nil {
+					logger.Error("failed to get assets", "kind", kind, "error", err)
+					continue
+				}
+
+				selected, err := selectAssets(assets, arg)
+				if err != nil {
+					logger.Error("failed to get assets", "kind", kind, "episode", arg, "error", err)
+					continue
+				}
+
+				targets = append(targets, selected...)
+			}
+
+			if !wantKind(funimation.EpisodeAsset) {
+				continue
+			}
+
 			if arg == "*" {
 				if eps, err := series.GetAllEpisodes(); err != nil {
-					log.Println("Failed to get all episodes: ", err)
+					logger.Error("failed to get all episodes", "error", err)
 					continue
 				} else {
 					episodes = eps
@@ -180,55 +829,76 @@ func doDownload(cmd *flag.FlagSet) {
 			} else if strings.ContainsRune(arg, '-') {
 				startEnd := strings.Split(arg, "-")
 				if len(startEnd) != 2 {
-					log.Printf("Range value `%s` must contain 1 dash character\n", arg)
+					logger.Error("range value must contain 1 dash character", "range", arg)
 					continue
 				}
 
 				start, err := strconv.ParseInt(startEnd[0], 10, 32)
 				if err != nil {
-					log.Println("Range value must be numeric")
+					logger.Error("range value must be numeric", "range", arg)
 					continue
 				}
 
 				end, err := strconv.ParseInt(startEnd[1], 10, 32)
 				if err != nil {
-					log.Println("Range value must be numeric")
+					logger.Error("range value must be numeric", "range", arg)
 					continue
 				}
 
 				eps, err := series.GetEpisodesRange(int(start), int(end))
 				if err != nil {
-					log.Println(err)
+					logger.Error("failed to get episodes", "range", arg, "error", err)
 					continue
 				}
 
 				episodes = append(episodes, eps...)
-			} else if epNum, err := strconv.ParseInt(arg, 10, 32); err != nil {
-				episode, err := series.GetEpisodeBySlug(arg)
-				if err != nil {
-					log.Println("Failed to get episode: ", err)
-					continue
-				}
-
-				episodes = append(episodes, episode)
 			} else {
+				epNum, _ := strconv.ParseInt(arg, 10, 32)
 				episode, err := series.GetEpisode(int(epNum))
 				if err != nil {
-					log.Println("Failed to get episode: ", err)
+					logger.Error("failed to get episode", "episode", arg, "error", err)
 					continue
 				}
 
 				episodes = append(episodes, episode)
 			}
 		}
+
+		for _, episode := range episodes {
+			targets = append(targets, newTarget(episode))
+		}
+	}
+
+	return targets
+}
+
+func doDownload(cmd *flag.FlagSet) {
+	show := cmd.Arg(0)
+	if show == "" || !strings.HasPrefix(show, "http") && cmd.Arg(1) == "" {
+		cmd.Usage()
+		os.Exit(2)
+	}
+
+	if email := cmd.Lookup("email").Value.(flag.Getter).Get().(string); email != "" {
+		password := cmd.Lookup("password").Value.(flag.Getter).Get().(string)
+
+		if password == "" {
+			fatal("got `email` flag but missing `password` flag")
+		}
+
+		if err := funimationClient.Login(email, password); err != nil {
+			fatal("login failed", "error", err)
+		}
 	}
 
-	if len(episodes) == 0 {
+	targets := selectTargets(cmd)
+
+	if len(targets) == 0 {
 		cmd.Usage()
 		os.Exit(2)
 	}
 
-	fmt.Printf("Found %d episodes:\n", len(episodes))
+	fmt.Printf("Found %d videos:\n", len(targets))
 
 	quality := cmd.Lookup("quality").Value.(flag.Getter).Get().(string)
 	language := funimation.EpisodeLanguage(cmd.Lookup("language").Value.(flag.Getter).Get().(string))
@@ -236,16 +906,56 @@ func doDownload(cmd *flag.FlagSet) {
 	threads := cmd.Lookup("threads").Value.(flag.Getter).Get().(int)
 	guessUrls := cmd.Lookup("guess").Value.(flag.Getter).Get().(bool)
 
+	queue := download.NewQueue(cmd.Lookup("jobs").Value.(flag.Getter).Get().(int))
+	queue.Retries = cmd.Lookup("retries").Value.(flag.Getter).Get().(int)
+	queue.Verify = cmd.Lookup("verify").Value.(flag.Getter).Get().(bool)
+	queue.Client = funimationClient.MediaHttpClient()
+	queue.TempDir = tempDir
+
+	if limitRate := cmd.Lookup("limit-rate").Value.(flag.Getter).Get().(string); limitRate != "" {
+		bytesPerSecond, err := humanize.ParseBytes(limitRate)
+		if err != nil {
+			fatal("bad `limit-rate` flag", "error", err)
+		}
+
+		var windows []download.Window
+		if fullSpeed := cmd.Lookup("full-speed").Value.(flag.Getter).Get().(string); fullSpeed != "" {
+			for _, w := range strings.Split(fullSpeed, ",") {
+				window, err := download.ParseWindow(w)
+				if err != nil {
+					fatal("bad `full-speed` flag", "error", err)
+				}
+
+				windows = append(windows, window)
+			}
+		}
+
+		queue.Limiter = download.NewLimiter(int64(bytesPerSecond), windows...)
+	}
+
+	switch format := cmd.Lookup("progress").Value.(flag.Getter).Get().(string); format {
+	case "auto":
+		queue.Progress = progress.New(os.Stdout)
+	case "bars":
+		queue.Progress = progress.NewBars(os.Stdout)
+	case "lines":
+		queue.Progress = progress.NewLines(os.Stdout)
+	case "json":
+		queue.Progress = progress.NewJSON(os.Stdout)
+	default:
+		fatal("unknown progress format", "format", format)
+	}
+
 	// default to subbed
 	if language != funimation.Subbed && language != funimation.Dubbed {
-		fmt.Println("Received unknown language mode; defaulting to sub")
+		logger.Warn("unknown language mode; defaulting to sub", "language", language)
 		language = funimation.Subbed
 	}
 
-	for _, episode := range episodes {
+	for _, t := range targets {
 		foundLang := false
 		hasSub := false
-		for _, l := range episode.Languages() {
+		for _, l := range t.video.Languages() {
 			if l == funimation.Subbed {
 				hasSub = true
 			}
@@ -257,55 +967,49 @@ func doDownload(cmd *flag.FlagSet) {
 		// make sure language is available
 		var el funimation.EpisodeLanguage = language
 		if !foundLang {
-			fmt.Printf("Language mode - %s - is unavailable; ", el)
-
 			// if subbed is unavailable, something is wrong... just give up...
 			if !hasSub {
-				log.Println("skipping...")
+				logger.Warn("language mode is unavailable; skipping", "video", t.name, "language", el)
 				continue
 			}
 
-			fmt.Println("defaulting to sub")
+			logger.Warn("language mode is unavailable; defaulting to sub", "video", t.name, "language", el)
 			el = funimation.Subbed
 		}
 
 		var eq funimation.EpisodeQuality
 		if quality == "max" {
-			eq = episode.GetBestQuality(el, !guessUrls)
+			eq = t.video.GetBestQuality(el, !guessUrls)
 		} else {
 			eq = funimation.ParseEpisodeQuality(quality)
 		}
 
-		urlFunc := episode.GetVideoUrl
-		if guessUrls {
-			urlFunc = episode.GuessVideoUrl
+		video := t.video
+		videoUrl := func() (string, error) {
+			if guessUrls {
+				return video.GuessVideoUrl(el, eq)
+			}
+
+			return video.GetVideoUrl(el, eq)
 		}
 
-		url, err := urlFunc(el, eq)
+		url, err := videoUrl()
 		if err != nil {
-			log.Println("Failed to get url: ", err)
+			var restricted *funimation.RestrictionError
+			if errors.As(err, &restricted) && restricted.ProxyMayHelp() {
+				logger.Error("failed to get url; a proxy in another country may help, see -proxy", "video", t.name, "language", el, "quality", eq.String(), "error", err)
+			} else {
+				logger.Error("failed to get url", "video", t.name, "language", el, "quality", eq.String(), "error", err)
+			}
 			continue
 		}
 
 		if urlOnly {
-			fmt.Printf("Season %d, %s %v: %s\n", episode.SeasonNumber(), episode.Type(), episode.EpisodeNumber(), url)
+			fmt.Printf("%s: %s\n", t.name, url)
 			continue
 		}
 
-		dl, err := downloader.New(url)
-		if err != nil {
-			log.Println("Failed to get downloader: ", err)
-			continue
-		}
-
-		var epnum interface{}
-		if episode.EpisodeNumber() == 0 {
-			epnum = ""
-		} else {
-			epnum = episode.EpisodeNumber()
-		}
-
-		fname := fmt.Sprintf("s%d%s%v - %s [%s][%s].mp4", episode.SeasonNumber(), episode.TypeCode(), epnum, episode.Title(), eq.String(), el)
+		fname := fmt.Sprintf("%s [%s][%s]%s", t.file, eq.String(), el, download.Ext(url))
 		fname = strings.Map(func(r rune) (rune) {
 			if r == '\\' || r == '/' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
 				return -1
@@ -313,71 +1017,52 @@ func doDownload(cmd *flag.FlagSet) {
 			return r
 		}, fname)
 
-		fmt.Printf("\nDownloading %s Season %d - %s %v\n", episode.Title(), episode.SeasonNumber(), episode.Type(), episode.EpisodeNumber())
-		fmt.Printf("Saving to: %s\n\n", fname)
-
-		startTime := time.Now()
-
-		bytesStrLen := len(humanize.Comma(dl.Size()))
-
-		var lastTime = time.Now()
-		var rate float64
-		var bytesSinceLastTime int64
-		var d *downloader.Download
-		dl.OnBytesReceived = func(bytes int) {
-			bytesSinceLastTime += int64(bytes)
-
-			percent := d.Percent()
-			newTime := time.Now()
-			timeDiff := newTime.Sub(lastTime)
-			if secs := timeDiff.Seconds(); secs >= 0.5 {
-				rate = float64(bytesSinceLastTime) / secs
-				lastTime = newTime
-				bytesSinceLastTime = 0
-			}
+		job := &download.Job{
+			Name: t.name,
+			Dest: fname,
+			Threads: threads,
+			Duration: t.video.Duration(el),
+		}
 
-			percentStr := fmt.Sprintf("%.2f", percent * float32(100))
-			for ; len(percentStr) < 6; {
-				percentStr = " " + percentStr
+		name := t.name
+		job.Url = func() (string, error) {
+			// the auth token in the url runs out during long batches, so
+			// get a fresh one from the video's page when it has
+			if !tokenRejected(job.Err()) && !video.TokenExpired() {
+				return url, nil
 			}
 
-			progBar := "["
-			progBarLen := 30
-			for i := 0; i < progBarLen; i++ {
-				if float32(i) < float32(progBarLen) * percent {
-					if progBar[len(progBar) - 1] == byte('>') {
-						progBar = progBar[:len(progBar) - 1] + "="
-					}
-					progBar += ">"
-				} else {
-					progBar += " "
-				}
+			fresh, err := video.Refresh()
+			if err != nil {
+				return "", err
 			}
-			progBar += "]"
 
-			bytesStr := humanize.Comma(int64(d.Current()))
-			for ; len(bytesStr) < bytesStrLen; {
-				bytesStr = " " + bytesStr
+			video = fresh
+			if url, err = videoUrl(); err != nil {
+				return "", err
 			}
 
-			rateStr := humanize.Bytes(uint64(rate))
-			for ; len(rateStr) < 10; {
-				rateStr = " " + rateStr
-			}
+			logger.Info("refreshed auth token", "video", name)
 
-			fmt.Printf("\r%s%% %s %s %s/s", percentStr, progBar, bytesStr, rateStr)
+			return url, nil
 		}
 
-		fmt.Println()
-		if d, err = dl.Download(fname, threads); err != nil {
-			log.Println("Failed to start download: ", err)
-		} else {
-			if err := d.Wait(); err != nil {
-				log.Println("\nDownload failed: ", err)
-				continue
-			}
+		queue.Add(job)
+	}
 
-			fmt.Printf("\nDownloaded %s in %v\n", humanize.Bytes(uint64(dl.Size())), time.Now().Sub(startTime))
-		}
+	if urlOnly || len(queue.Jobs()) == 0 {
+		return
+	}
+
+	fmt.Printf("\nDownloading %d videos, %d at a time\n\n", len(queue.Jobs()), queue.Concurrency)
+
+	startTime := time.Now()
+
+	failed := queue.Run()
+
+	fmt.Printf("\nFinished in %v\n", time.Now().Sub(startTime))
+
+	for _, job := range failed {
+		logger.Error("download failed", "file", job.Dest, "attempts", job.Attempts(), "error", job.Err())
 	}
 }
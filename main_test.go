@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"golang.ssttevee.com/funimation/lib"
+	"golang.ssttevee.com/funimation/lib/funimationtest"
+)
+
+// useFakeServer points the cli at a fake website and a temporary directory
+func useFakeServer(t *testing.T) *funimationtest.Server {
+	srv := funimationtest.NewDefaultServer()
+	t.Cleanup(srv.Close)
+
+	client := funimationClient
+	funimationClient = funimation.NewWithHttpClient(srv.Client())
+	t.Cleanup(func() {
+		funimationClient = client
+	})
+
+	tempDir = t.TempDir()
+	t.Chdir(t.TempDir())
+
+	return srv
+}
+
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+
+	f()
+	w.Close()
+
+	return <-out
+}
+
+func TestList(t *testing.T) {
+	useFakeServer(t)
+
+	out := captureStdout(t, func() {
+		doList("multi-season", []funimation.AssetKind{funimation.EpisodeAsset})
+	})
+
+	for _, want := range []string{"Multi Season", "2 Seasons, 7 Episodes", "Episode 3 - Episode 3 of Season 2", "OVA - The OVA"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDownloadUrlOnly(t *testing.T) {
+	srv := useFakeServer(t)
+
+	cmd := newDownloadCmd()
+	cmd.Parse([]string{"-url-only", "-language", "dub", "multi-season", "2-3"})
+
+	out := captureStdout(t, func() {
+		doDownload(cmd)
+	})
+
+	for _, want := range []string{"Found 2 videos", "Season 1, Episode 2: " + srv.URL + "/videos/MSS1E2dub-sd.mp4?token-MSS1E2dub", "Season 1, Episode 3: "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestListKinds(t *testing.T) {
+	useFakeServer(t)
+
+	out := captureStdout(t, func() {
+		doList("extras", []funimation.AssetKind{funimation.TrailerAsset, funimation.MovieAsset})
+	})
+
+	for _, want := range []string{"2 trailers:", "trailer - Season 1 Trailer", "trailer - Dub Trailer", "1 movies:", "movie - The Movie"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "Episodes") {
+		t.Errorf("output lists episodes:\n%s", out)
+	}
+}
+
+func TestDownloadKinds(t *testing.T) {
+	srv := useFakeServer(t)
+
+	cmd := newDownloadCmd()
+	cmd.Parse([]string{"-url-only", "-kind", "trailers,clip", "extras", "*"})
+
+	out := captureStdout(t, func() {
+		doDownload(cmd)
+	})
+
+	for _, want := range []string{"Found 3 videos", "trailer 2 - Dub Trailer: " + srv.URL + "/videos/EXS1E3sub-sd.mp4", "clip 1 - Opening Song: "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	useFakeServer(t)
+
+	cmd := newDoctorCmd()
+	cmd.Parse([]string{"-bundle", "bundle.zip", "multi-season"})
+
+	var ok bool
+	out := captureStdout(t, func() {
+		ok = doDoctor(cmd)
+	})
+
+	if !ok {
+		t.Errorf("expected every stage to pass:\n%s", out)
+	}
+
+	for _, want := range []string{"getShow      ok", "playersData  ok", "Wrote bundle.zip"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := os.Stat("bundle.zip"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLogFlags(t *testing.T) {
+	useFakeServer(t)
+
+	l := logger
+	t.Cleanup(func() {
+		logger = l
+	})
+
+	tests := []struct {
+		args  []string
+		level slog.Level
+	}{
+		{nil, slog.LevelInfo},
+		{[]string{"-v", "-log-format", "json"}, slog.LevelDebug},
+		{[]string{"-q"}, slog.LevelError},
+	}
+
+	for _, test := range tests {
+		cmd := newListCmd()
+		cmd.Parse(test.args)
+		setupLogging(cmd)
+
+		if !logger.Enabled(context.Background(), test.level) || logger.Enabled(context.Background(), test.level-1) {
+			t.Errorf("%v: logger is not at level %s", test.args, test.level)
+		}
+	}
+}
+
+func TestProxySettings(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("FUNIMATION_PROXY", "")
+	t.Setenv("FUNIMATION_PROXY_ROUTE", "")
+
+	if err := os.MkdirAll(filepath.Join(dir, "funimation"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "funimation", "config.json"), []byte(`{"proxy": "socks5://config:1080", "proxyRoute": "media"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(args []string, wantProxy, wantRoute string) {
+		t.Helper()
+
+		cmd := newDownloadCmd()
+		cmd.Parse(args)
+
+		proxy, route, err := proxySettings(cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if proxy != wantProxy || route != wantRoute {
+			t.Errorf("%v: got %s %s, want %s %s", args, proxy, route, wantProxy, wantRoute)
+		}
+	}
+
+	check(nil, "socks5://config:1080", "media")
+
+	t.Setenv("FUNIMATION_PROXY", "http://env:8080")
+	check(nil, "http://env:8080", "media")
+
+	t.Setenv("FUNIMATION_PROXY_ROUTE", "metadata")
+	check([]string{"-proxy", "http://flag:8080"}, "http://flag:8080", "metadata")
+	check([]string{"-proxy-route", "all"}, "http://env:8080", "all")
+}
+
+func TestDownload(t *testing.T) {
+	useFakeServer(t)
+
+	cmd := newDownloadCmd()
+	cmd.Parse([]string{"-progress", "lines", "-jobs", "2", "multi-season", "1", "5"})
+
+	out := captureStdout(t, func() {
+		doDownload(cmd)
+	})
+
+	files, _ := filepath.Glob("*.mp4")
+	if len(files) != 2 {
+		t.Fatalf("got files %v, want 2 videos\n%s", files, out)
+	}
+
+	for _, want := range []string{"s1e1 - Episode 1 of Season 1 [480p][sub].mp4", "s2e2 - Episode 2 of Season 2 [480p][sub].mp4"} {
+		b, err := os.ReadFile(want)
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Equal(b, funimationtest.VideoFile(1440e9)) {
+			t.Errorf("%s has the wrong content", want)
+		}
+	}
+}
+
+func TestDownloadRefreshesToken(t *testing.T) {
+	srv := useFakeServer(t)
+
+	// the token runs out as the download starts
+	srv.Fail(&funimationtest.Failure{Path: "/videos/MSS1E1sub", Count: 1, Status: 403, ExpireTokens: true})
+
+	cmd := newDownloadCmd()
+	cmd.Parse([]string{"-progress", "lines", "multi-season", "1"})
+
+	out := captureStdout(t, func() {
+		doDownload(cmd)
+	})
+
+	want := "s1e1 - Episode 1 of Season 1 [480p][sub].mp4"
+	if b, err := os.ReadFile(want); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	} else if !bytes.Equal(b, funimationtest.VideoFile(1440e9)) {
+		t.Errorf("%s has the wrong content", want)
+	}
+
+	pages := 0
+	for _, req := range srv.Requests() {
+		if strings.HasSuffix(req, "/MS-episode-1-1") {
+			pages++
+		}
+	}
+
+	if pages != 2 {
+		t.Errorf("fetched the episode page %d times, want 2", pages)
+	}
+}
+
+func TestGuess(t *testing.T) {
+	useFakeServer(t)
+
+	cmd := newGuessCmd()
+	cmd.Parse([]string{"-quality", "sd", "multi-season", "1"})
+
+	var ok bool
+	out := captureStdout(t, func() {
+		ok = doGuess(cmd)
+	})
+
+	if !ok {
+		t.Fatalf("found nothing:\n%s", out)
+	}
+
+	if !strings.Contains(out, "edgecast") || !strings.Contains(out, "MSS1E1sub-480-1500K.mp4") || strings.Contains(out, "-750K.mp4") {
+		t.Errorf("got output:\n%s", out)
+	}
+
+	if !strings.Contains(out, "Found 1 videos") {
+		t.Errorf("got output:\n%s", out)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	useFakeServer(t)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"territory-blocked", "1"},
+			[]string{"Season 1, Episode 1:", "480p", "1080p", "200, ", "This video is not available in your territory", "not offered", "\n1 of 1 videos can be downloaded"},
+		},
+		{
+			// both languages of each episode can be downloaded, but each
+			// episode is counted once
+			[]string{"multi-season", "1-2"},
+			[]string{"sub", "dub", "This video is members only", "\n2 of 2 videos can be downloaded"},
+		},
+	}
+
+	for _, test := range tests {
+		cmd := newProbeCmd()
+		cmd.Parse(test.args)
+
+		var ok bool
+		out := captureStdout(t, func() {
+			ok = doProbe(cmd)
+		})
+
+		if !ok {
+			t.Fatalf("%v: nothing can be downloaded:\n%s", test.args, out)
+		}
+
+		for _, want := range test.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: missing %q in output:\n%s", test.args, want, out)
+			}
+		}
+	}
+}